@@ -0,0 +1,334 @@
+package config
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const defaultJWTSecret = "your-secret-key-change-in-production"
+
+// AccessTokenAudience is the aud claim of access tokens, the only tokens
+// other services should accept. Tokens for the steps of a login flow are
+// signed with the same keys but carry an audience of their own, so one kind
+// cannot pass for another.
+const AccessTokenAudience = "go-chat"
+
+// accessTokenType is the typ header of access tokens (RFC 9068).
+const accessTokenType = "at+jwt"
+
+// verificationKey is a public key that tokens may be signed with.
+type verificationKey struct {
+	kid    string
+	method jwt.SigningMethod
+	public crypto.PublicKey
+}
+
+// keyring holds the active signing key plus every key still accepted for
+// verification, so keys can be rotated without invalidating issued tokens.
+type keyring struct {
+	signingKID   string
+	signingKey   crypto.PrivateKey
+	keys         map[string]*verificationKey
+	hmacSecret   []byte
+	acceptHMAC   bool
+	validMethods []string
+}
+
+var activeKeyring *keyring
+
+// LoadKeys initializes token signing from the environment.
+//
+// When JWT_KEYS_DIR is set, every <kid>.pem file in it (RSA or Ed25519, private
+// or public) is loaded for verification and published via JWKS, and the
+// private key named by JWT_ACTIVE_KID signs new tokens. Otherwise tokens are
+// signed with HS256 using JWT_SECRET. With APP_ENV=production, startup fails
+// if the default secret would be used.
+func LoadKeys() error {
+	ring := &keyring{keys: make(map[string]*verificationKey)}
+
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		secret = defaultJWTSecret
+	}
+	ring.hmacSecret = []byte(secret)
+
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		if IsProduction() && secret == defaultJWTSecret {
+			return errors.New("refusing to start in production with the default JWT secret: set JWT_SECRET or JWT_KEYS_DIR")
+		}
+		ring.acceptHMAC = true
+		ring.validMethods = []string{jwt.SigningMethodHS256.Alg()}
+		activeKeyring = ring
+		log.Println("JWT signing with HS256 shared secret")
+		return nil
+	}
+
+	if err := ring.loadDir(dir); err != nil {
+		return err
+	}
+
+	ring.signingKID = os.Getenv("JWT_ACTIVE_KID")
+	if ring.signingKID == "" {
+		return errors.New("JWT_ACTIVE_KID is required when JWT_KEYS_DIR is set")
+	}
+	if ring.signingKey == nil {
+		return fmt.Errorf("no private key found for active kid %q", ring.signingKID)
+	}
+
+	// Allow HS256 tokens issued before the switch to asymmetric keys to keep
+	// working until they expire
+	if os.Getenv("JWT_ACCEPT_LEGACY_HS256") == "true" {
+		if IsProduction() && secret == defaultJWTSecret {
+			return errors.New("refusing to accept legacy HS256 tokens signed with the default JWT secret")
+		}
+		ring.acceptHMAC = true
+	}
+
+	methods := map[string]bool{}
+	for _, key := range ring.keys {
+		methods[key.method.Alg()] = true
+	}
+	if ring.acceptHMAC {
+		methods[jwt.SigningMethodHS256.Alg()] = true
+	}
+	for method := range methods {
+		ring.validMethods = append(ring.validMethods, method)
+	}
+
+	activeKeyring = ring
+	log.Printf("JWT signing with key %s (%d verification keys loaded)", ring.signingKID, len(ring.keys))
+	return nil
+}
+
+// IsProduction reports whether APP_ENV is set to production.
+func IsProduction() bool {
+	return strings.EqualFold(os.Getenv("APP_ENV"), "production")
+}
+
+func (r *keyring) loadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no .pem keys found in %s", dir)
+	}
+
+	activeKID := os.Getenv("JWT_ACTIVE_KID")
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		private, public, err := parsePEMKey(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse key %s: %w", file, err)
+		}
+
+		method, err := signingMethodFor(public)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", file, err)
+		}
+
+		r.keys[kid] = &verificationKey{kid: kid, method: method, public: public}
+		if kid == activeKID && private != nil {
+			r.signingKey = private
+		}
+	}
+
+	return nil
+}
+
+func parsePEMKey(data []byte) (crypto.PrivateKey, crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			return k, &k.PublicKey, nil
+		case ed25519.PrivateKey:
+			return k, k.Public(), nil
+		}
+		return nil, nil, errors.New("unsupported private key type")
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, &key.PublicKey, nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, key, nil
+	}
+
+	return nil, nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+func signingMethodFor(public crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch public.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, errors.New("unsupported public key type")
+}
+
+// SignToken signs claims for audience with the active key, adding a kid
+// header for asymmetric keys.
+func SignToken(claims jwt.MapClaims, audience string) (string, error) {
+	ring := activeKeyring
+	if ring == nil {
+		return "", errors.New("signing keys not loaded")
+	}
+
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		claims["iss"] = issuer
+	}
+	claims["aud"] = audience
+
+	var token *jwt.Token
+	if ring.signingKey == nil {
+		token = jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	} else {
+		token = jwt.NewWithClaims(ring.keys[ring.signingKID].method, claims)
+		token.Header["kid"] = ring.signingKID
+	}
+	if audience == AccessTokenAudience {
+		token.Header["typ"] = accessTokenType
+	}
+
+	if ring.signingKey == nil {
+		return token.SignedString(ring.hmacSecret)
+	}
+	return token.SignedString(ring.signingKey)
+}
+
+// ParseToken verifies a token meant for audience against the keyring and
+// returns its claims. Access tokens must also carry the at+jwt type, which no
+// other token may claim.
+func ParseToken(tokenString, audience string) (jwt.MapClaims, error) {
+	ring := activeKeyring
+	if ring == nil {
+		return nil, errors.New("signing keys not loaded")
+	}
+
+	options := []jwt.ParserOption{jwt.WithValidMethods(ring.validMethods), jwt.WithAudience(audience)}
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		options = append(options, jwt.WithIssuer(issuer))
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if isAccess := token.Header["typ"] == accessTokenType; isAccess != (audience == AccessTokenAudience) {
+			return nil, errors.New("unexpected token type")
+		}
+
+		if _, isHMAC := token.Method.(*jwt.SigningMethodHMAC); isHMAC {
+			if !ring.acceptHMAC {
+				return nil, errors.New("HMAC tokens are not accepted")
+			}
+			return ring.hmacSecret, nil
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ring.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if key.method.Alg() != token.Method.Alg() {
+			return nil, errors.New("signing method does not match key")
+		}
+		return key.public, nil
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+
+	return claims, nil
+}
+
+// JWKS returns the public verification keys in JSON Web Key Set format.
+// It is empty when tokens are signed with a shared HS256 secret.
+func JWKS() map[string]interface{} {
+	keys := []map[string]interface{}{}
+
+	if ring := activeKeyring; ring != nil {
+		kids := make([]string, 0, len(ring.keys))
+		for kid := range ring.keys {
+			kids = append(kids, kid)
+		}
+		sort.Strings(kids)
+
+		for _, kid := range kids {
+			if jwk := publicJWK(ring.keys[kid]); jwk != nil {
+				keys = append(keys, jwk)
+			}
+		}
+	}
+
+	return map[string]interface{}{"keys": keys}
+}
+
+func publicJWK(key *verificationKey) map[string]interface{} {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		return map[string]interface{}{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": key.method.Alg(),
+			"kid": key.kid,
+			"n":   encode(public.N.Bytes()),
+			"e":   encode(big.NewInt(int64(public.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return map[string]interface{}{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"use": "sig",
+			"alg": key.method.Alg(),
+			"kid": key.kid,
+			"x":   encode(public),
+		}
+	}
+
+	return nil
+}
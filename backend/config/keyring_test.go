@@ -0,0 +1,52 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTokensOnlyParseForTheirAudience(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("JWT_KEYS_DIR", "")
+	if err := LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	const challengeAudience = "go-chat/2fa-challenge"
+	sign := func(audience string) string {
+		token, err := SignToken(jwt.MapClaims{"user_id": 1, "exp": time.Now().Add(time.Minute).Unix()}, audience)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	access, challenge := sign(AccessTokenAudience), sign(challengeAudience)
+
+	if _, err := ParseToken(access, AccessTokenAudience); err != nil {
+		t.Errorf("access token rejected as access token: %v", err)
+	}
+	if _, err := ParseToken(challenge, challengeAudience); err != nil {
+		t.Errorf("challenge token rejected as challenge token: %v", err)
+	}
+	if _, err := ParseToken(challenge, AccessTokenAudience); err == nil {
+		t.Error("challenge token accepted as access token")
+	}
+	if _, err := ParseToken(access, challengeAudience); err == nil {
+		t.Error("access token accepted as challenge token")
+	}
+
+	// The aud claim alone is not enough without the access token type
+	untyped, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": 1,
+		"aud":     AccessTokenAudience,
+		"exp":     time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseToken(untyped, AccessTokenAudience); err == nil {
+		t.Error("token without the at+jwt type accepted as access token")
+	}
+}
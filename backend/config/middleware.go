@@ -1,17 +1,33 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"chat-backend/database"
 	"chat-backend/models"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
+// TrustedProxies lists the proxies, as IPs or CIDRs, whose X-Forwarded-For
+// and X-Real-IP headers are believed when working out a client's IP. It is
+// read from the comma-separated TRUSTED_PROXIES and is nil by default, so
+// forwarded headers are ignored unless the deployment names its proxies.
+func TrustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
@@ -41,17 +57,18 @@ func AuthMiddleware() gin.HandlerFunc {
 			}
 		}
 
-		// Fall back to query parameter (for WebSocket connections)
-		if tokenString == "" {
-			tokenString = c.Query("token")
-		}
-
 		if tokenString == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization required"})
 			c.Abort()
 			return
 		}
 
+		// Personal access tokens are opaque and looked up by hash
+		if strings.HasPrefix(tokenString, models.PersonalAccessTokenPrefix) {
+			authenticatePersonalAccessToken(c, tokenString)
+			return
+		}
+
 		// Check if token is blacklisted
 		var blacklistedToken models.TokenBlacklist
 		if err := database.DB.Where("token = ?", tokenString).First(&blacklistedToken).Error; err == nil {
@@ -60,41 +77,122 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(getJWTSecret()), nil
-		})
-
-		if err != nil || !token.Valid {
+		// 2FA challenges and other login flow tokens have their own audience
+		// and are rejected here
+		claims, err := ParseToken(tokenString, AccessTokenAudience)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
+		userID, ok := claims["user_id"].(float64)
 		if !ok {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
 			c.Abort()
 			return
 		}
 
-		userID := uint(claims["user_id"].(float64))
 		var user models.User
-		if err := database.DB.First(&user, userID).Error; err != nil {
+		if err := database.DB.First(&user, uint(userID)).Error; err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			c.Abort()
 			return
 		}
 
+		// Reject tokens issued up to the moment the user's sessions were
+		// revoked; iat has whole-second precision, so a token from the same
+		// second could predate the revocation
+		if user.TokensRevokedAt != nil {
+			issuedAt, _ := claims["iat"].(float64)
+			if int64(issuedAt) <= user.TokensRevokedAt.Unix() {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+				c.Abort()
+				return
+			}
+		}
+
 		c.Set("user", user)
 		c.Set("token", tokenString)
 		c.Next()
 	}
 }
 
-func getJWTSecret() string {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "your-secret-key-change-in-production"
+func authenticatePersonalAccessToken(c *gin.Context, tokenString string) {
+	var pat models.PersonalAccessToken
+	if err := database.DB.Where("token_hash = ?", HashToken(tokenString)).First(&pat).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return
+	}
+
+	now := time.Now()
+	if pat.ExpiresAt != nil && now.After(*pat.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has expired"})
+		c.Abort()
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, pat.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.Abort()
+		return
+	}
+
+	// Avoid a write on every request; minute precision is enough for last-used tracking
+	if pat.LastUsedAt == nil || now.Sub(*pat.LastUsedAt) > time.Minute {
+		database.DB.Model(&pat).Update("last_used_at", now)
+	}
+
+	c.Set("user", user)
+	c.Set("token_scopes", pat.ScopeList())
+	c.Next()
+}
+
+// HashToken returns the hex SHA-256 digest stored in place of a random
+// secret, such as a personal access token or a WebSocket ticket. The secrets
+// carry enough entropy that a fast unsalted hash is sufficient.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequireScope lets personal access tokens through only if they carry the
+// given scope. Regular session tokens have every scope.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasScope(c, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Token is missing the " + scope + " scope"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// SessionOnly rejects personal access tokens, for account management routes.
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isPAT := c.Get("token_scopes"); isPAT {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint requires a user session"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// HasScope reports whether the authenticated request may use scope.
+func HasScope(c *gin.Context, scope string) bool {
+	value, isPAT := c.Get("token_scopes")
+	if !isPAT {
+		return true
+	}
+	for _, granted := range value.([]string) {
+		if granted == scope {
+			return true
+		}
 	}
-	return secret
+	return false
 }
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func scopeTestContext(scopes []string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if scopes != nil {
+		c.Set("token_scopes", scopes)
+	}
+	return c, recorder
+}
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string // nil for a session token
+		scope  string
+		want   bool
+	}{
+		{"session has every scope", nil, models.ScopeMessagesWrite, true},
+		{"granted scope", []string{models.ScopeMessagesRead, models.ScopeMessagesWrite}, models.ScopeMessagesWrite, true},
+		{"missing scope", []string{models.ScopeMessagesRead}, models.ScopeMessagesWrite, false},
+		{"token without scopes", []string{}, models.ScopeUsersRead, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := scopeTestContext(tt.scopes)
+			if got := HasScope(c, tt.scope); got != tt.want {
+				t.Errorf("HasScope(%q) = %v, want %v", tt.scope, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireScopeAbortsWithoutScope(t *testing.T) {
+	c, recorder := scopeTestContext([]string{models.ScopeMessagesRead})
+	RequireScope(models.ScopeMessagesWrite)(c)
+
+	if !c.IsAborted() || recorder.Code != http.StatusForbidden {
+		t.Errorf("RequireScope = %d (aborted %v), want %d", recorder.Code, c.IsAborted(), http.StatusForbidden)
+	}
+}
+
+func TestSessionOnlyRejectsPersonalAccessTokens(t *testing.T) {
+	c, recorder := scopeTestContext([]string{models.ScopeMessagesRead, models.ScopeMessagesWrite})
+	SessionOnly()(c)
+	if !c.IsAborted() || recorder.Code != http.StatusForbidden {
+		t.Errorf("SessionOnly with a token = %d (aborted %v), want %d", recorder.Code, c.IsAborted(), http.StatusForbidden)
+	}
+
+	c, _ = scopeTestContext(nil)
+	SessionOnly()(c)
+	if c.IsAborted() {
+		t.Error("SessionOnly rejected a session")
+	}
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	breachedPasswords     map[string]struct{}
+	breachedPasswordsOnce sync.Once
+)
+
+// ValidatePassword checks a new password against the configured policy:
+// PASSWORD_MIN_LENGTH (default 6) and an optional breached-password list
+// read from PASSWORD_BREACHED_LIST_FILE (one password per line).
+func ValidatePassword(password string) error {
+	minLength := 6
+	if value := os.Getenv("PASSWORD_MIN_LENGTH"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			minLength = parsed
+		}
+	}
+
+	if len(password) < minLength {
+		return fmt.Errorf("Password must be at least %d characters", minLength)
+	}
+
+	// bcrypt ignores everything past 72 bytes
+	if len(password) > 72 {
+		return errors.New("Password must be at most 72 bytes")
+	}
+
+	breachedPasswordsOnce.Do(loadBreachedPasswords)
+	if _, found := breachedPasswords[strings.ToLower(password)]; found {
+		return errors.New("Password has appeared in a data breach, please choose another")
+	}
+
+	return nil
+}
+
+func loadBreachedPasswords() {
+	breachedPasswords = make(map[string]struct{})
+
+	path := os.Getenv("PASSWORD_BREACHED_LIST_FILE")
+	if path == "" {
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Printf("Failed to open breached password list: %v", err)
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		breachedPasswords[strings.ToLower(line)] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Printf("Failed to read breached password list: %v", err)
+	}
+
+	log.Printf("Loaded %d breached passwords", len(breachedPasswords))
+}
@@ -22,8 +22,41 @@ func CleanupExpiredTokens() {
 	}
 }
 
+// CleanupStaleLoginAttempts removes login throttling records that are no longer locked
+// and have not seen a failure for a day
+func CleanupStaleLoginAttempts() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		result := DB.Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-24*time.Hour), now).
+			Delete(&models.LoginAttempt{})
+		if result.Error != nil {
+			log.Printf("Error cleaning up login attempts: %v", result.Error)
+		} else if result.RowsAffected > 0 {
+			log.Printf("Cleaned up %d stale login attempts", result.RowsAffected)
+		}
+	}
+}
+
+// CleanupExpiredWSTickets removes WebSocket tickets that were never redeemed
+func CleanupExpiredWSTickets() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result := DB.Where("expires_at < ?", time.Now()).Delete(&models.WSTicket{})
+		if result.Error != nil {
+			log.Printf("Error cleaning up WebSocket tickets: %v", result.Error)
+		}
+	}
+}
+
 // StartBackgroundTasks starts all background tasks
 func StartBackgroundTasks() {
 	go CleanupExpiredTokens()
+	go CleanupStaleLoginAttempts()
+	go CleanupExpiredWSTickets()
 	log.Println("Background tasks started")
 }
@@ -68,11 +68,36 @@ func Migrate() {
 		&models.Conversation{},
 		&models.Message{},
 		&models.TokenBlacklist{},
+		&models.BackupCode{},
+		&models.LoginAttempt{},
+		&models.AuditLog{},
+		&models.UserIdentity{},
+		&models.PersonalAccessToken{},
+		&models.WSTicket{},
+		&models.UserBlock{},
+		&models.FriendRequest{},
+		&models.Contact{},
+		&models.MessageMention{},
+		&models.ConversationReadState{},
+		&models.PinnedMessage{},
+		&models.ScheduledMessage{},
+		&models.Poll{},
+		&models.PollOption{},
+		&models.PollVote{},
+		&models.LinkPreview{},
+		&models.VoicePlay{},
+		&models.StarredMessage{},
+		&models.Draft{},
 	)
 
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	// User search ranks with trigram similarity (see migration 000014)
+	if err := DB.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		log.Printf("Failed to enable pg_trgm, user search will not work: %v", err)
+	}
+
 	log.Println("Database migrated successfully (AutoMigrate - use 'make migrate-up' for production)")
 }
@@ -3,9 +3,11 @@ package main
 import (
 	"log"
 	"os"
+	"path/filepath"
 
 	"chat-backend/config"
 	"chat-backend/database"
+	"chat-backend/models"
 	"chat-backend/routes"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +20,11 @@ func main() {
 		log.Println("No .env file found")
 	}
 
+	// Load JWT signing keys (refuses the default secret in production)
+	if err := config.LoadKeys(); err != nil {
+		log.Fatal("Failed to load JWT signing keys: ", err)
+	}
+
 	// Initialize database
 	database.Connect()
 	database.Migrate()
@@ -29,9 +36,21 @@ func main() {
 	hub := routes.NewHub()
 	go hub.Run()
 
+	// Send scheduled messages when they fall due
+	go routes.RunMessageScheduler(hub)
+
+	// Delete disappearing messages once they expire
+	go routes.RunMessageExpiry(hub)
+
 	// Setup router
 	router := gin.Default()
 
+	// Client IPs feed the login throttle and audit log, so forwarded headers
+	// are only trusted from configured proxies
+	if err := router.SetTrustedProxies(config.TrustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+
 	// CORS middleware
 	router.Use(config.CORSMiddleware())
 
@@ -40,6 +59,15 @@ func main() {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	// Uploaded avatars
+	router.Static("/uploads/avatars", filepath.Join(routes.UploadDir(), "avatars"))
+
+	// Uploaded voice notes
+	router.Static("/uploads/voice", filepath.Join(routes.UploadDir(), "voice"))
+
+	// Public keys for verifying chat tokens in other services
+	router.GET("/.well-known/jwks.json", routes.GetJWKS)
+
 	// API routes
 	api := router.Group("/api/v1")
 	{
@@ -48,6 +76,11 @@ func main() {
 		{
 			auth.POST("/register", routes.Register)
 			auth.POST("/login", routes.Login)
+			auth.POST("/login/2fa", routes.LoginTwoFactor)
+
+			// OpenID Connect single sign-on
+			auth.GET("/oidc/login", routes.OIDCLogin)
+			auth.GET("/oidc/callback", routes.OIDCCallback)
 		}
 
 		// Protected routes
@@ -55,22 +88,132 @@ func main() {
 		protected.Use(config.AuthMiddleware())
 		{
 			// Auth routes (protected)
-			protected.POST("/auth/logout", routes.Logout)
+			protected.POST("/auth/logout", config.SessionOnly(), routes.Logout)
+
+			// Two-factor authentication
+			protected.POST("/auth/2fa/enroll", config.SessionOnly(), routes.EnrollTwoFactor)
+			protected.POST("/auth/2fa/confirm", config.SessionOnly(), routes.ConfirmTwoFactor)
+			protected.POST("/auth/2fa/disable", config.SessionOnly(), routes.DisableTwoFactor)
+
+			// Personal access tokens and bots
+			protected.POST("/tokens", config.SessionOnly(), routes.CreateAPIToken)
+			protected.GET("/tokens", config.SessionOnly(), routes.GetAPITokens)
+			protected.DELETE("/tokens/:id", config.SessionOnly(), routes.DeleteAPIToken)
+			protected.POST("/bots", config.SessionOnly(), routes.CreateBot)
+			protected.GET("/bots", config.SessionOnly(), routes.GetBots)
+			protected.DELETE("/bots/:id", config.SessionOnly(), routes.DeleteBot)
+			protected.POST("/bots/:id/tokens", config.SessionOnly(), routes.CreateBotToken)
+			protected.GET("/bots/:id/tokens", config.SessionOnly(), routes.GetBotTokens)
 
 			// User routes
-			protected.GET("/users/me", routes.GetCurrentUser)
-			protected.GET("/users", routes.GetUsers)
+			protected.GET("/users/me", config.RequireScope(models.ScopeUsersRead), routes.GetCurrentUser)
+			protected.PATCH("/users/me", config.SessionOnly(), func(c *gin.Context) {
+				routes.UpdateProfile(hub, c)
+			})
+			protected.PUT("/users/me/avatar", config.SessionOnly(), func(c *gin.Context) {
+				routes.UploadAvatar(hub, c)
+			})
+			protected.DELETE("/users/me/avatar", config.SessionOnly(), func(c *gin.Context) {
+				routes.DeleteAvatar(hub, c)
+			})
+			protected.POST("/users/me/password", config.SessionOnly(), func(c *gin.Context) {
+				routes.ChangePassword(hub, c)
+			})
+			protected.PUT("/users/me/status", config.SessionOnly(), func(c *gin.Context) {
+				routes.UpdateStatus(hub, c)
+			})
+			protected.PATCH("/users/me/privacy", config.SessionOnly(), func(c *gin.Context) {
+				routes.UpdatePrivacy(hub, c)
+			})
+			protected.GET("/users", config.RequireScope(models.ScopeUsersRead), routes.GetUsers)
+
+			// Blocking
+			protected.GET("/blocks", config.SessionOnly(), routes.GetBlockedUsers)
+			protected.POST("/blocks", config.SessionOnly(), routes.BlockUser)
+			protected.DELETE("/blocks/:id", config.SessionOnly(), routes.UnblockUser)
+
+			// Contacts and friend requests
+			protected.GET("/contacts", config.SessionOnly(), routes.GetContacts)
+			protected.DELETE("/contacts/:id", config.SessionOnly(), routes.RemoveContact)
+			protected.GET("/friend-requests", config.SessionOnly(), routes.GetFriendRequests)
+			protected.POST("/friend-requests", config.SessionOnly(), func(c *gin.Context) {
+				routes.SendFriendRequest(hub, c)
+			})
+			protected.POST("/friend-requests/:id/accept", config.SessionOnly(), func(c *gin.Context) {
+				routes.AcceptFriendRequest(hub, c)
+			})
+			protected.POST("/friend-requests/:id/decline", config.SessionOnly(), func(c *gin.Context) {
+				routes.DeclineFriendRequest(hub, c)
+			})
+			protected.DELETE("/friend-requests/:id", config.SessionOnly(), func(c *gin.Context) {
+				routes.CancelFriendRequest(hub, c)
+			})
 
 			// Conversation routes
-			protected.POST("/conversations", routes.CreateConversation)
-			protected.GET("/conversations", routes.GetConversations)
-			protected.GET("/conversations/:id/messages", routes.GetMessages)
+			protected.POST("/conversations", config.RequireScope(models.ScopeConversationsWrite), routes.CreateConversation)
+			protected.GET("/conversations", config.RequireScope(models.ScopeConversationsRead), routes.GetConversations)
+			protected.GET("/conversations/:id/messages", config.RequireScope(models.ScopeMessagesRead), routes.GetMessages)
+			protected.POST("/conversations/:id/read", config.RequireScope(models.ScopeMessagesRead), routes.MarkConversationRead)
+			protected.PUT("/conversations/:id/mute", config.RequireScope(models.ScopeConversationsWrite), routes.MuteConversation)
+			protected.PUT("/conversations/:id/draft", config.RequireScope(models.ScopeMessagesWrite), func(c *gin.Context) {
+				routes.SaveDraft(hub, c)
+			})
+			protected.PUT("/conversations/:id/disappearing", config.RequireScope(models.ScopeConversationsWrite), func(c *gin.Context) {
+				routes.SetDisappearingTimer(hub, c)
+			})
+			protected.POST("/conversations/:id/polls", config.RequireScope(models.ScopeMessagesWrite), func(c *gin.Context) {
+				routes.CreatePoll(hub, c)
+			})
+			protected.POST("/conversations/:id/voice", config.RequireScope(models.ScopeMessagesWrite), func(c *gin.Context) {
+				routes.SendVoiceNote(hub, c)
+			})
+			protected.GET("/conversations/:id/pins", config.RequireScope(models.ScopeMessagesRead), routes.GetPinnedMessages)
+			protected.POST("/conversations/:id/pins", config.RequireScope(models.ScopeMessagesWrite), func(c *gin.Context) {
+				routes.PinMessage(hub, c)
+			})
+			protected.DELETE("/conversations/:id/pins/:messageId", config.RequireScope(models.ScopeMessagesWrite), func(c *gin.Context) {
+				routes.UnpinMessage(hub, c)
+			})
 
-			// WebSocket
-			protected.GET("/ws", func(c *gin.Context) {
-				routes.ServeWs(hub, c)
+			// Polls
+			protected.GET("/polls/:id", config.RequireScope(models.ScopeMessagesRead), routes.GetPoll)
+			protected.POST("/polls/:id/votes", config.RequireScope(models.ScopeMessagesWrite), func(c *gin.Context) {
+				routes.VotePoll(hub, c)
+			})
+			protected.DELETE("/polls/:id/votes", config.RequireScope(models.ScopeMessagesWrite), func(c *gin.Context) {
+				routes.RetractPollVote(hub, c)
 			})
+			protected.POST("/polls/:id/close", config.RequireScope(models.ScopeMessagesWrite), func(c *gin.Context) {
+				routes.ClosePoll(hub, c)
+			})
+
+			// Message actions
+			protected.POST("/messages/forward", config.RequireScope(models.ScopeMessagesWrite), func(c *gin.Context) {
+				routes.ForwardMessages(hub, c)
+			})
+			protected.POST("/messages/:id/played", config.RequireScope(models.ScopeMessagesWrite), func(c *gin.Context) {
+				routes.MarkVoicePlayed(hub, c)
+			})
+
+			// Starred messages
+			protected.GET("/starred", config.RequireScope(models.ScopeMessagesRead), routes.GetStarredMessages)
+			protected.POST("/messages/:id/star", config.RequireScope(models.ScopeMessagesWrite), routes.StarMessage)
+			protected.DELETE("/messages/:id/star", config.RequireScope(models.ScopeMessagesWrite), routes.UnstarMessage)
+
+			// Scheduled messages
+			protected.POST("/scheduled-messages", config.RequireScope(models.ScopeMessagesWrite), routes.CreateScheduledMessage)
+			protected.GET("/scheduled-messages", config.RequireScope(models.ScopeMessagesRead), routes.GetScheduledMessages)
+			protected.PATCH("/scheduled-messages/:id", config.RequireScope(models.ScopeMessagesWrite), routes.UpdateScheduledMessage)
+			protected.DELETE("/scheduled-messages/:id", config.RequireScope(models.ScopeMessagesWrite), routes.CancelScheduledMessage)
+
+			// WebSocket connection tickets
+			protected.POST("/ws/ticket", config.RequireScope(models.ScopeMessagesRead), routes.CreateWSTicket)
 		}
+
+		// WebSocket (authenticated with a single-use ticket, never a bearer token)
+		api.GET("/ws", func(c *gin.Context) {
+			routes.ServeWs(hub, c)
+		})
 	}
 
 	port := os.Getenv("PORT")
@@ -0,0 +1,7 @@
+-- Drop user_backup_codes table
+DROP TABLE IF EXISTS user_backup_codes;
+
+-- Remove two-factor authentication columns from users
+ALTER TABLE users DROP COLUMN IF EXISTS totp_last_step;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_secret;
+ALTER TABLE users DROP COLUMN IF EXISTS two_factor_enabled;
@@ -0,0 +1,2 @@
+-- Tokens issued before this timestamp are rejected (set on password change)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_revoked_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS update_user_identities_updated_at ON user_identities;
+DROP TABLE IF EXISTS user_identities;
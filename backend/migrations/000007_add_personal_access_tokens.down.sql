@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS personal_access_tokens;
+
+ALTER TABLE users DROP COLUMN IF EXISTS bot_owner_id;
+ALTER TABLE users DROP COLUMN IF EXISTS is_bot;
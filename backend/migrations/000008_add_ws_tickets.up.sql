@@ -0,0 +1,12 @@
+-- Create ws_tickets table (single-use WebSocket connection tickets)
+CREATE TABLE IF NOT EXISTS ws_tickets (
+    id SERIAL PRIMARY KEY,
+    ticket_hash VARCHAR(64) UNIQUE NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    can_write BOOLEAN DEFAULT TRUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ws_tickets_user_id ON ws_tickets(user_id);
+CREATE INDEX IF NOT EXISTS idx_ws_tickets_expires_at ON ws_tickets(expires_at);
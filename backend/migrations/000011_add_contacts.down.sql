@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS contacts;
+DROP TRIGGER IF EXISTS update_friend_requests_updated_at ON friend_requests;
+DROP TABLE IF EXISTS friend_requests;
@@ -0,0 +1,3 @@
+-- Add presence privacy settings to users
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_visibility VARCHAR(20) NOT NULL DEFAULT 'everyone';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_seen_visibility VARCHAR(20) NOT NULL DEFAULT 'everyone';
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_users_custom_status_expires_at;
+ALTER TABLE users DROP COLUMN IF EXISTS custom_status_expires_at;
+ALTER TABLE users DROP COLUMN IF EXISTS custom_status_emoji;
+ALTER TABLE users DROP COLUMN IF EXISTS custom_status_text;
+ALTER TABLE users DROP COLUMN IF EXISTS presence;
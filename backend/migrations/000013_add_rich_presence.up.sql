@@ -0,0 +1,8 @@
+-- Add chosen presence and custom status to users
+ALTER TABLE users ADD COLUMN IF NOT EXISTS presence VARCHAR(20) NOT NULL DEFAULT 'online';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS custom_status_text VARCHAR(100);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS custom_status_emoji VARCHAR(32);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS custom_status_expires_at TIMESTAMP WITH TIME ZONE;
+
+-- Create index for expiring custom statuses
+CREATE INDEX IF NOT EXISTS idx_users_custom_status_expires_at ON users(custom_status_expires_at);
@@ -0,0 +1,11 @@
+-- Enable trigram matching for the user directory search
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Create trigram indexes for fuzzy and substring matches
+CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING GIN (lower(username) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_display_name_trgm ON users USING GIN (lower(display_name) gin_trgm_ops);
+
+-- Create indexes for prefix matches on short terms and exact email lookups
+CREATE INDEX IF NOT EXISTS idx_users_username_prefix ON users (lower(username) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_users_display_name_prefix ON users (lower(display_name) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users (lower(email));
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS update_conversation_read_states_updated_at ON conversation_read_states;
+DROP TABLE IF EXISTS conversation_read_states;
+DROP TABLE IF EXISTS message_mentions;
@@ -0,0 +1,29 @@
+-- Create message_mentions table (one row per mentioned user)
+CREATE TABLE IF NOT EXISTS message_mentions (
+    id SERIAL PRIMARY KEY,
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('user', 'all', 'here')),
+    "offset" INTEGER NOT NULL,
+    length INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_mentions_message_id ON message_mentions(message_id);
+CREATE INDEX IF NOT EXISTS idx_message_mentions_user_id ON message_mentions(user_id);
+
+-- Create conversation_read_states table
+CREATE TABLE IF NOT EXISTS conversation_read_states (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    last_read_message_id INTEGER NOT NULL DEFAULT 0,
+    muted BOOLEAN NOT NULL DEFAULT FALSE,
+    muted_until TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, conversation_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_read_states_conversation_id ON conversation_read_states(conversation_id);
+
+CREATE TRIGGER update_conversation_read_states_updated_at BEFORE UPDATE ON conversation_read_states
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
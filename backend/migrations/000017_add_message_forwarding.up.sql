@@ -0,0 +1,5 @@
+-- Add forwarding attribution to messages
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from_message_id INTEGER REFERENCES messages(id) ON DELETE SET NULL;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from_sender_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from_sender_name VARCHAR(100);
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from_conversation_id INTEGER REFERENCES conversations(id) ON DELETE SET NULL;
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS update_scheduled_messages_updated_at ON scheduled_messages;
+DROP TABLE IF EXISTS scheduled_messages;
@@ -0,0 +1,27 @@
+-- Create scheduled_messages table
+CREATE TABLE IF NOT EXISTS scheduled_messages (
+    id SERIAL PRIMARY KEY,
+    conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    sender_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content TEXT,
+    type VARCHAR(50) DEFAULT 'text',
+    media_url VARCHAR(1000),
+    reply_to_id INTEGER REFERENCES messages(id) ON DELETE SET NULL,
+    send_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    time_zone VARCHAR(64),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'cancelled', 'failed')),
+    message_id INTEGER REFERENCES messages(id) ON DELETE SET NULL,
+    failure_reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_conversation_id ON scheduled_messages(conversation_id);
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_sender_id ON scheduled_messages(sender_id);
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_status ON scheduled_messages(status);
+
+-- The scheduler only scans pending rows that are due
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_due ON scheduled_messages(send_at) WHERE status = 'pending';
+
+CREATE TRIGGER update_scheduled_messages_updated_at BEFORE UPDATE ON scheduled_messages
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,8 @@
+DELETE FROM messages WHERE type = 'system';
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_type_check;
+ALTER TABLE messages ADD CONSTRAINT messages_type_check
+    CHECK (type IN ('text', 'image', 'video', 'audio', 'file'));
+
+DROP INDEX IF EXISTS idx_messages_expires_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE conversations DROP COLUMN IF EXISTS message_ttl;
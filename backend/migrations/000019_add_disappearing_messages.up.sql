@@ -0,0 +1,11 @@
+-- Add per-conversation disappearing message timers
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS message_ttl INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages(expires_at);
+
+-- Timer changes are announced with system messages
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_type_check;
+ALTER TABLE messages ADD CONSTRAINT messages_type_check
+    CHECK (type IN ('text', 'image', 'video', 'audio', 'file', 'system'));
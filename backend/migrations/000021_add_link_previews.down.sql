@@ -0,0 +1,2 @@
+ALTER TABLE messages DROP COLUMN IF EXISTS link_preview_id;
+DROP TABLE IF EXISTS link_previews;
@@ -0,0 +1,15 @@
+-- Create link_previews table (cache keyed by URL)
+CREATE TABLE IF NOT EXISTS link_previews (
+    id SERIAL PRIMARY KEY,
+    url VARCHAR(2048) NOT NULL,
+    title VARCHAR(300),
+    description TEXT,
+    image_url VARCHAR(2048),
+    site_name VARCHAR(200),
+    failed BOOLEAN NOT NULL DEFAULT FALSE,
+    fetched_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_link_previews_url ON link_previews(url);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS link_preview_id INTEGER REFERENCES link_previews(id) ON DELETE SET NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE scheduled_messages DROP COLUMN IF EXISTS format;
+
+ALTER TABLE messages DROP COLUMN IF EXISTS formatting;
+ALTER TABLE messages DROP COLUMN IF EXISTS markup;
+ALTER TABLE messages DROP COLUMN IF EXISTS format;
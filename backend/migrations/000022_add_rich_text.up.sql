@@ -0,0 +1,6 @@
+-- Add markdown formatting to messages
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS format VARCHAR(20) NOT NULL DEFAULT 'plain';
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS markup TEXT;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS formatting JSONB;
+
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS format VARCHAR(20) NOT NULL DEFAULT 'plain';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS voice_plays;
+ALTER TABLE messages DROP COLUMN IF EXISTS attachment;
@@ -0,0 +1,12 @@
+-- Add attachment metadata (duration, waveform) to messages
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS attachment JSONB;
+
+-- Create voice_plays table (per-recipient played state)
+CREATE TABLE IF NOT EXISTS voice_plays (
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    played_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (message_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_voice_plays_user_id ON voice_plays(user_id);
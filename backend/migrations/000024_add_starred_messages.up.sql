@@ -0,0 +1,12 @@
+-- Create starred_messages table (per-user bookmarks)
+CREATE TABLE IF NOT EXISTS starred_messages (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_starred_messages_message_id ON starred_messages(message_id);
+
+-- The starred listing pages through a user's stars, newest first
+CREATE INDEX IF NOT EXISTS idx_starred_messages_user_id_created_at ON starred_messages(user_id, created_at);
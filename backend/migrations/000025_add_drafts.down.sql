@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS update_drafts_updated_at ON drafts;
+DROP TABLE IF EXISTS drafts;
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// PersonalAccessTokenPrefix marks personal access tokens so the auth
+// middleware can tell them apart from JWTs.
+const PersonalAccessTokenPrefix = "gcp_"
+
+// Scopes that can be granted to personal access tokens
+const (
+	ScopeMessagesRead       = "messages:read"
+	ScopeMessagesWrite      = "messages:write"
+	ScopeConversationsRead  = "conversations:read"
+	ScopeConversationsWrite = "conversations:write"
+	ScopeUsersRead          = "users:read"
+)
+
+var ValidScopes = map[string]bool{
+	ScopeMessagesRead:       true,
+	ScopeMessagesWrite:      true,
+	ScopeConversationsRead:  true,
+	ScopeConversationsWrite: true,
+	ScopeUsersRead:          true,
+}
+
+// PersonalAccessToken is a long-lived, scoped credential for scripts and bots.
+// Only the SHA-256 hash of the token is stored.
+type PersonalAccessToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"not null" json:"name"`
+	TokenHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	Prefix     string     `json:"prefix"` // First characters of the token, for identification
+	Scopes     string     `gorm:"type:text" json:"-"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ScopeList returns the granted scopes.
+func (t *PersonalAccessToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(t.Scopes, ",")
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Attachment describes a message's media file. Duration and waveform are
+// extracted on upload for voice notes.
+type Attachment struct {
+	MimeType   string `json:"mime_type"`
+	Size       int64  `json:"size"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	Waveform   []int  `json:"waveform,omitempty"` // Loudness per bucket, 0-100
+}
+
+// VoicePlay records that a recipient played a voice note, the voice note
+// equivalent of a read receipt.
+type VoicePlay struct {
+	MessageID uint      `gorm:"primaryKey" json:"message_id"`
+	UserID    uint      `gorm:"primaryKey;index" json:"user_id"`
+	PlayedAt  time.Time `gorm:"not null" json:"played_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// UserBlock records that BlockerID has blocked BlockedID.
+type UserBlock struct {
+	BlockerID uint      `gorm:"primaryKey" json:"blocker_id"`
+	BlockedID uint      `gorm:"primaryKey;index" json:"blocked_id"`
+	Blocked   User      `gorm:"foreignKey:BlockedID" json:"blocked,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+type FriendRequestStatus string
+
+const (
+	FriendRequestPending   FriendRequestStatus = "pending"
+	FriendRequestAccepted  FriendRequestStatus = "accepted"
+	FriendRequestDeclined  FriendRequestStatus = "declined"
+	FriendRequestCancelled FriendRequestStatus = "cancelled"
+)
+
+type FriendRequest struct {
+	ID          uint                `gorm:"primaryKey" json:"id"`
+	SenderID    uint                `gorm:"not null;index" json:"sender_id"`
+	Sender      User                `gorm:"foreignKey:SenderID" json:"sender,omitempty"`
+	RecipientID uint                `gorm:"not null;index" json:"recipient_id"`
+	Recipient   User                `gorm:"foreignKey:RecipientID" json:"recipient,omitempty"`
+	Status      FriendRequestStatus `gorm:"not null;default:'pending';index" json:"status"`
+	RespondedAt *time.Time          `json:"responded_at,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+// Contact is stored once per direction, so a friendship is two rows.
+type Contact struct {
+	UserID    uint      `gorm:"primaryKey" json:"user_id"`
+	ContactID uint      `gorm:"primaryKey;index" json:"contact_id"`
+	Contact   User      `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// SystemMessage is posted by the server itself, e.g. when a conversation's
+// settings change. Clients cannot send it.
+const SystemMessage MessageType = "system"
+
+// DisappearingTimers maps the allowed message lifetimes, in seconds, to how
+// they are described in system messages. 0 turns disappearing messages off.
+var DisappearingTimers = map[int]string{
+	0:      "off",
+	3600:   "1 hour",
+	86400:  "24 hours",
+	604800: "7 days",
+}
+
+// MessageExpiry returns when a message sent at now should disappear, or nil
+// when the conversation keeps messages.
+func (c Conversation) MessageExpiry(now time.Time) *time.Time {
+	if c.MessageTTL <= 0 {
+		return nil
+	}
+	expiresAt := now.Add(time.Duration(c.MessageTTL) * time.Second)
+	return &expiresAt
+}
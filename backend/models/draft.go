@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Draft is a user's unsent message in a conversation, kept server-side so it
+// follows them across devices.
+type Draft struct {
+	UserID         uint      `gorm:"primaryKey" json:"-"`
+	ConversationID uint      `gorm:"primaryKey;index" json:"conversation_id"`
+	Content        string    `gorm:"type:text;not null" json:"content"`
+	ReplyToID      *uint     `json:"reply_to_id,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -0,0 +1,10 @@
+package models
+
+// ForwardedFrom attributes a forwarded message to where it was first sent.
+// Forwarding a forwarded message keeps the original attribution.
+type ForwardedFrom struct {
+	MessageID      *uint  `json:"message_id,omitempty"`
+	SenderID       *uint  `json:"sender_id,omitempty"`
+	SenderName     string `json:"sender_name,omitempty"` // Snapshot, readable even by users who do not know the sender
+	ConversationID *uint  `json:"conversation_id,omitempty"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// LinkPreview caches OpenGraph/oEmbed metadata for one URL. Failed fetches
+// are cached too, so a broken link is not retried for every message.
+type LinkPreview struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	URL         string    `gorm:"size:2048;uniqueIndex;not null" json:"url"`
+	Title       string    `gorm:"size:300" json:"title,omitempty"`
+	Description string    `gorm:"type:text" json:"description,omitempty"`
+	ImageURL    string    `gorm:"size:2048" json:"image_url,omitempty"`
+	SiteName    string    `gorm:"size:200" json:"site_name,omitempty"`
+	Failed      bool      `gorm:"not null;default:false" json:"-"`
+	FetchedAt   time.Time `gorm:"not null" json:"fetched_at"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// MessageFormat says how a message's content was written.
+type MessageFormat string
+
+const (
+	FormatPlain    MessageFormat = "plain"
+	FormatMarkdown MessageFormat = "markdown" // See routes/markup.go for the supported subset
+)
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+type MentionKind string
+
+const (
+	MentionUser MentionKind = "user" // @username
+	MentionAll  MentionKind = "all"  // @all: every participant
+	MentionHere MentionKind = "here" // @here: participants currently online
+)
+
+// MessageMention records that a message mentions UserID. An @all or @here
+// token produces one row per resolved user, all sharing the same range.
+// Offset and Length are in UTF-16 code units, matching JavaScript and Dart
+// string indexing.
+type MessageMention struct {
+	ID        uint        `gorm:"primaryKey" json:"id"`
+	MessageID uint        `gorm:"not null;index" json:"message_id"`
+	UserID    uint        `gorm:"not null;index" json:"user_id"`
+	Kind      MentionKind `gorm:"not null" json:"kind"`
+	Offset    int         `gorm:"not null" json:"offset"`
+	Length    int         `gorm:"not null" json:"length"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// MessageEntity is a range of a message's content with special meaning,
+// returned with messages so clients can render mentions and formatting.
+type MessageEntity struct {
+	Type     string `json:"type"` // mention, mention_all, mention_here, or a formatting type from routes/markup.go
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length"`
+	UserID   *uint  `json:"user_id,omitempty"`
+	URL      string `json:"url,omitempty"`      // text_link
+	Language string `json:"language,omitempty"` // pre
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PinnedMessage marks a message as pinned in its conversation.
+type PinnedMessage struct {
+	MessageID      uint      `gorm:"primaryKey" json:"message_id"`
+	ConversationID uint      `gorm:"not null;index" json:"conversation_id"`
+	PinnedByID     uint      `gorm:"not null" json:"pinned_by_id"`
+	PinnedBy       User      `gorm:"foreignKey:PinnedByID;constraint:OnDelete:CASCADE" json:"pinned_by,omitempty"`
+	CreatedAt      time.Time `json:"pinned_at"`
+}
+
+// pinner is the part of the pinner's profile every participant may see, the
+// same fields as a public profile in the API.
+type pinner struct {
+	ID          uint   `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	Avatar      string `json:"avatar"`
+}
+
+// MarshalJSON replaces the pinner with their public profile, leaving out
+// contact details and presence.
+func (p PinnedMessage) MarshalJSON() ([]byte, error) {
+	type pin PinnedMessage
+	view := struct {
+		pin
+		PinnedBy *pinner `json:"pinned_by,omitempty"`
+	}{pin: pin(p)}
+
+	if p.PinnedBy.ID != 0 {
+		view.PinnedBy = &pinner{
+			ID:          p.PinnedBy.ID,
+			Username:    p.PinnedBy.Username,
+			DisplayName: p.PinnedBy.DisplayName,
+			Bio:         p.PinnedBy.Bio,
+			Avatar:      p.PinnedBy.Avatar,
+		}
+	}
+	return json.Marshal(view)
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPinnedMessageShowsOnlyThePinnersPublicProfile(t *testing.T) {
+	message := Message{
+		ID: 1,
+		Pin: &PinnedMessage{
+			MessageID:  1,
+			PinnedByID: 2,
+			PinnedBy: User{
+				ID:       2,
+				Username: "alice",
+				Email:    "alice@example.com",
+				Phone:    "+15550100",
+				Status:   "online",
+				LastSeen: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+			},
+			CreatedAt: time.Now(),
+		},
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, private := range []string{"alice@example.com", "+15550100", "online", "2026-01-02"} {
+		if strings.Contains(string(data), private) {
+			t.Errorf("pinned message JSON contains %q: %s", private, data)
+		}
+	}
+
+	var decoded struct {
+		Pin struct {
+			PinnedByID uint      `json:"pinned_by_id"`
+			PinnedAt   time.Time `json:"pinned_at"`
+			PinnedBy   struct {
+				ID       uint   `json:"id"`
+				Username string `json:"username"`
+			} `json:"pinned_by"`
+		} `json:"pin"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Pin.PinnedByID != 2 || decoded.Pin.PinnedBy.ID != 2 || decoded.Pin.PinnedBy.Username != "alice" || decoded.Pin.PinnedAt.IsZero() {
+		t.Errorf("pinned message JSON = %s, want the pinner's id, username and the pin time", data)
+	}
+}
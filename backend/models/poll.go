@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// PollMessage is a message carrying a Poll; its content is the question.
+const PollMessage MessageType = "poll"
+
+// Poll belongs to a poll message. Votes on anonymous polls are tallied but
+// never attributed.
+type Poll struct {
+	ID             uint         `gorm:"primaryKey" json:"id"`
+	MessageID      uint         `gorm:"not null;uniqueIndex" json:"message_id"`
+	ConversationID uint         `gorm:"not null;index" json:"conversation_id"`
+	Question       string       `gorm:"type:text;not null" json:"question"`
+	MultipleChoice bool         `gorm:"not null;default:false" json:"multiple_choice"`
+	Anonymous      bool         `gorm:"not null;default:false" json:"anonymous"`
+	ClosesAt       *time.Time   `json:"closes_at,omitempty"`
+	ClosedAt       *time.Time   `json:"closed_at,omitempty"` // Set when the creator closes the poll early
+	Options        []PollOption `gorm:"foreignKey:PollID;constraint:OnDelete:CASCADE" json:"options"`
+	CreatedAt      time.Time    `json:"created_at"`
+
+	// Tallies, filled in for the viewer
+	Closed      bool   `gorm:"-" json:"closed"`
+	TotalVoters int    `gorm:"-" json:"total_voters"`
+	MyVotes     []uint `gorm:"-" json:"my_votes,omitempty"`
+}
+
+// IsClosed reports whether voting has ended at now.
+func (p Poll) IsClosed(now time.Time) bool {
+	return p.ClosedAt != nil || (p.ClosesAt != nil && !p.ClosesAt.After(now))
+}
+
+type PollOption struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	PollID   uint   `gorm:"not null;index" json:"poll_id"`
+	Position int    `gorm:"not null" json:"position"`
+	Text     string `gorm:"size:200;not null" json:"text"`
+
+	// Declared so AutoMigrate removes votes with their option; never loaded
+	Votes []PollVote `gorm:"foreignKey:OptionID;constraint:OnDelete:CASCADE" json:"-"`
+
+	VoteCount int    `gorm:"-" json:"vote_count"`
+	Voters    []uint `gorm:"-" json:"voters,omitempty"` // Left out for anonymous polls
+}
+
+// PollVote is one user's vote for one option; multiple-choice polls allow
+// several per user.
+type PollVote struct {
+	OptionID  uint      `gorm:"primaryKey" json:"option_id"`
+	UserID    uint      `gorm:"primaryKey;index" json:"user_id"`
+	PollID    uint      `gorm:"not null;index" json:"poll_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"sync"
+	"testing"
+
+	"gorm.io/gorm/schema"
+)
+
+func TestPollRowsCascadeWithTheirMessage(t *testing.T) {
+	tests := []struct {
+		model    interface{}
+		relation string
+	}{
+		{&Message{}, "Poll"},
+		{&Poll{}, "Options"},
+		{&PollOption{}, "Votes"},
+	}
+
+	cache := &sync.Map{}
+	for _, tt := range tests {
+		s, err := schema.Parse(tt.model, cache, schema.NamingStrategy{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		relation, ok := s.Relationships.Relations[tt.relation]
+		if !ok {
+			t.Fatalf("%s has no %s relation", s.Name, tt.relation)
+		}
+		if constraint := relation.ParseConstraint(); constraint == nil || constraint.OnDelete != "CASCADE" {
+			t.Errorf("%s.%s constraint = %+v, want ON DELETE CASCADE", s.Name, tt.relation, constraint)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// PresenceStatus is the availability a user has chosen. The status other
+// users see is derived from it together with the connection and idle state.
+type PresenceStatus string
+
+const (
+	PresenceOnline    PresenceStatus = "online"
+	PresenceAway      PresenceStatus = "away"
+	PresenceDND       PresenceStatus = "dnd"
+	PresenceInvisible PresenceStatus = "invisible" // Connected but shown as offline
+)
+
+// ValidPresence lists the presence values a user can choose.
+var ValidPresence = map[PresenceStatus]bool{
+	PresenceOnline:    true,
+	PresenceAway:      true,
+	PresenceDND:       true,
+	PresenceInvisible: true,
+}
+
+// EffectiveStatus returns the status shown to other users: offline, away,
+// dnd or online.
+func EffectiveStatus(presence PresenceStatus, connected, idle bool) string {
+	switch {
+	case !connected || presence == PresenceInvisible:
+		return "offline"
+	case presence == PresenceDND:
+		return "dnd"
+	case presence == PresenceAway || idle:
+		return "away"
+	}
+	return "online"
+}
+
+// CustomStatusActive reports whether the user has a custom status that has
+// not expired.
+func (u *User) CustomStatusActive(now time.Time) bool {
+	if u.CustomStatusText == "" && u.CustomStatusEmoji == "" {
+		return false
+	}
+	return u.CustomStatusExpiresAt == nil || u.CustomStatusExpiresAt.After(now)
+}
+
+// ClearCustomStatus removes the custom status.
+func (u *User) ClearCustomStatus() {
+	u.CustomStatusText = ""
+	u.CustomStatusEmoji = ""
+	u.CustomStatusExpiresAt = nil
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEffectiveStatus(t *testing.T) {
+	tests := []struct {
+		presence  PresenceStatus
+		connected bool
+		idle      bool
+		want      string
+	}{
+		{PresenceOnline, true, false, "online"},
+		{PresenceOnline, true, true, "away"},
+		{PresenceOnline, false, false, "offline"},
+		{PresenceAway, true, false, "away"},
+		{PresenceAway, true, true, "away"},
+		{PresenceAway, false, false, "offline"},
+		{PresenceDND, true, false, "dnd"},
+		{PresenceDND, true, true, "dnd"}, // Idling does not lift do-not-disturb
+		{PresenceDND, false, false, "offline"},
+		{PresenceInvisible, true, false, "offline"},
+		{PresenceInvisible, true, true, "offline"},
+		{PresenceInvisible, false, false, "offline"},
+	}
+
+	for _, tt := range tests {
+		if got := EffectiveStatus(tt.presence, tt.connected, tt.idle); got != tt.want {
+			t.Errorf("EffectiveStatus(%s, connected=%v, idle=%v) = %s, want %s",
+				tt.presence, tt.connected, tt.idle, got, tt.want)
+		}
+	}
+}
+
+func TestCustomStatusActive(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	tests := []struct {
+		name      string
+		text      string
+		emoji     string
+		expiresAt *time.Time
+		want      bool
+	}{
+		{"no custom status", "", "", nil, false},
+		{"text without expiry", "In a meeting", "", nil, true},
+		{"emoji only", "", "🌴", &future, true},
+		{"expired", "Lunch", "", &past, false},
+		{"expires exactly now", "Lunch", "", &now, false},
+	}
+
+	for _, tt := range tests {
+		user := User{CustomStatusText: tt.text, CustomStatusEmoji: tt.emoji, CustomStatusExpiresAt: tt.expiresAt}
+		if got := user.CustomStatusActive(now); got != tt.want {
+			t.Errorf("%s: CustomStatusActive = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package models
+
+// PresenceVisibility controls who can see a user's status or last seen time.
+type PresenceVisibility string
+
+const (
+	VisibilityEveryone PresenceVisibility = "everyone"
+	VisibilityContacts PresenceVisibility = "contacts"
+	VisibilityNobody   PresenceVisibility = "nobody"
+)
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// ConversationReadState tracks how far a participant has read a conversation
+// and whether they muted it.
+type ConversationReadState struct {
+	UserID            uint       `gorm:"primaryKey" json:"user_id"`
+	ConversationID    uint       `gorm:"primaryKey;index" json:"conversation_id"`
+	LastReadMessageID uint       `gorm:"default:0" json:"last_read_message_id"`
+	Muted             bool       `gorm:"default:false" json:"muted"`
+	MutedUntil        *time.Time `json:"muted_until,omitempty"` // nil while muted means indefinitely
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// IsMuted reports whether the conversation is muted at now.
+func (s *ConversationReadState) IsMuted(now time.Time) bool {
+	return s.Muted && (s.MutedUntil == nil || s.MutedUntil.After(now))
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+type ScheduledMessageStatus string
+
+const (
+	ScheduledPending   ScheduledMessageStatus = "pending"
+	ScheduledSent      ScheduledMessageStatus = "sent"
+	ScheduledCancelled ScheduledMessageStatus = "cancelled"
+	ScheduledFailed    ScheduledMessageStatus = "failed"
+)
+
+// ScheduledMessage is a message to be sent at SendAt. Once sent, MessageID
+// points at the real message.
+type ScheduledMessage struct {
+	ID             uint                   `gorm:"primaryKey" json:"id"`
+	ConversationID uint                   `gorm:"not null;index" json:"conversation_id"`
+	SenderID       uint                   `gorm:"not null;index" json:"sender_id"`
+	Content        string                 `gorm:"type:text" json:"content"`
+	Type           MessageType            `gorm:"default:'text'" json:"type"`
+	Format         MessageFormat          `gorm:"size:20;not null;default:'plain'" json:"format"`
+	MediaURL       string                 `json:"media_url,omitempty"`
+	ReplyToID      *uint                  `json:"reply_to_id,omitempty"`
+	SendAt         time.Time              `gorm:"not null;index" json:"send_at"`
+	TimeZone       string                 `json:"time_zone,omitempty"` // Zone the sender picked SendAt in, for display
+	Status         ScheduledMessageStatus `gorm:"not null;default:'pending';index" json:"status"`
+	MessageID      *uint                  `json:"message_id,omitempty"`
+	FailureReason  string                 `json:"failure_reason,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+	UpdatedAt      time.Time              `json:"updated_at"`
+}
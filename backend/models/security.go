@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// LoginAttempt tracks consecutive failed logins for a throttling key
+// such as "ip:203.0.113.7" or "account:alice@example.com".
+type LoginAttempt struct {
+	Key           string     `gorm:"primaryKey" json:"key"`
+	Failures      int        `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time  `gorm:"index" json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// AuditLog records security-relevant events such as account lockouts.
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Event     string    `gorm:"not null;index" json:"event"`
+	UserID    *uint     `gorm:"index" json:"user_id,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	Details   string    `gorm:"type:text" json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// StarredMessage bookmarks a message for one user. Stars are private; other
+// participants never see them.
+type StarredMessage struct {
+	UserID    uint      `gorm:"primaryKey;index:idx_starred_messages_user_id_created_at,priority:1" json:"user_id"`
+	MessageID uint      `gorm:"primaryKey;index" json:"message_id"`
+	CreatedAt time.Time `gorm:"index:idx_starred_messages_user_id_created_at,priority:2" json:"starred_at"`
+}
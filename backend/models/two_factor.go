@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// BackupCode is a single-use 2FA recovery code. Only the SHA-256 hash is stored.
+type BackupCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (BackupCode) TableName() string {
+	return "user_backup_codes"
+}
@@ -18,6 +18,32 @@ type User struct {
 	LastSeen  time.Time `json:"last_seen"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// Profile
+	DisplayName string `json:"display_name,omitempty"`
+	Bio         string `gorm:"type:text" json:"bio,omitempty"`
+
+	// Two-factor authentication; only shown to the user themselves (see ownProfile)
+	TwoFactorEnabled bool   `gorm:"default:false" json:"-"`
+	TOTPSecret       string `json:"-"`
+	TOTPLastStep     int64  `json:"-"` // Last accepted TOTP time step, prevents code reuse
+
+	// Tokens issued before this time are rejected (set on password change)
+	TokensRevokedAt *time.Time `json:"-"`
+
+	// Bot accounts authenticate only with personal access tokens
+	IsBot      bool  `gorm:"default:false" json:"is_bot"`
+	BotOwnerID *uint `gorm:"index" json:"bot_owner_id,omitempty"`
+
+	// Presence privacy: who may see status and last_seen
+	StatusVisibility   PresenceVisibility `gorm:"default:'everyone'" json:"status_visibility"`
+	LastSeenVisibility PresenceVisibility `gorm:"default:'everyone'" json:"last_seen_visibility"`
+
+	// Chosen availability (Status holds what others see) and custom status
+	Presence              PresenceStatus `gorm:"default:'online'" json:"presence,omitempty"`
+	CustomStatusText      string         `json:"custom_status_text,omitempty"`
+	CustomStatusEmoji     string         `json:"custom_status_emoji,omitempty"`
+	CustomStatusExpiresAt *time.Time     `gorm:"index" json:"custom_status_expires_at,omitempty"`
 }
 
 func (u *User) HashPassword(password string) error {
@@ -52,6 +78,17 @@ type Conversation struct {
 	Messages     []Message        `gorm:"foreignKey:ConversationID" json:"messages,omitempty"`
 	CreatedAt    time.Time        `json:"created_at"`
 	UpdatedAt    time.Time        `json:"updated_at"`
+
+	// Per-viewer state, filled in by GetConversations
+	UnreadCount        int64 `gorm:"-" json:"unread_count"`
+	UnreadMentionCount int64 `gorm:"-" json:"unread_mention_count"`
+	Muted              bool  `gorm:"-" json:"muted"`
+
+	// Lifetime of new messages in seconds, 0 when they do not disappear
+	MessageTTL int `gorm:"not null;default:0" json:"message_ttl"`
+
+	// The viewer's unsent draft, filled in by GetConversations
+	Draft *Draft `gorm:"-" json:"draft,omitempty"`
 }
 
 // models/message.go
@@ -83,10 +120,46 @@ type Message struct {
 	Status         MessageStatus  `gorm:"default:'sent'" json:"status"`
 	MediaURL       string         `json:"media_url,omitempty"`
 	ReplyToID      *uint          `json:"reply_to_id,omitempty"`
-	ReplyTo        *Message       `gorm:"foreignKey:ReplyToID" json:"reply_to,omitempty"`
+	ReplyTo        *Message       `gorm:"foreignKey:ReplyToID;constraint:OnDelete:SET NULL" json:"reply_to,omitempty"`
 	CreatedAt      time.Time      `json:"created_at"`
 	UpdatedAt      time.Time      `json:"updated_at"`
 	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Mention and formatting ranges, loaded from message_mentions and Formatting
+	Entities []MessageEntity `gorm:"-" json:"entities,omitempty"`
+
+	// For markdown messages Content holds the plain-text rendering, used for
+	// previews and notifications, and Markup the source as written
+	Format     MessageFormat   `gorm:"size:20;not null;default:'plain'" json:"format"`
+	Markup     string          `gorm:"type:text" json:"markup,omitempty"`
+	Formatting []MessageEntity `gorm:"serializer:json;type:jsonb" json:"-"`
+
+	// Set when the message is pinned in its conversation
+	Pin *PinnedMessage `gorm:"foreignKey:MessageID;constraint:OnDelete:CASCADE" json:"pin,omitempty"`
+	// Set on messages created by forwarding
+	ForwardedFrom ForwardedFrom `gorm:"embedded;embeddedPrefix:forwarded_from_" json:"forwarded_from,omitzero"`
+
+	// Set in conversations with disappearing messages; the row is
+	// hard-deleted once it passes
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"`
+
+	// Set on poll messages
+	Poll *Poll `gorm:"foreignKey:MessageID;constraint:OnDelete:CASCADE" json:"poll,omitempty"`
+
+	// Preview of the first link in the content, attached after sending
+	LinkPreviewID *uint        `json:"-"`
+	LinkPreview   *LinkPreview `gorm:"foreignKey:LinkPreviewID" json:"link_preview,omitempty"`
+
+	// Metadata of the file at MediaURL, set for uploaded voice notes
+	Attachment *Attachment `gorm:"serializer:json;type:jsonb" json:"attachment,omitempty"`
+
+	// Voice note play state for the viewer: Played for recipients, PlayedBy
+	// for the sender
+	Played   bool   `gorm:"-" json:"played,omitempty"`
+	PlayedBy []uint `gorm:"-" json:"played_by,omitempty"`
+
+	// Whether the viewer starred the message
+	Starred bool `gorm:"-" json:"starred,omitempty"`
 }
 
 // models/token_blacklist.go
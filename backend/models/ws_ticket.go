@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// WSTicket is a short-lived, single-use credential for opening a WebSocket
+// connection, so long-lived tokens never appear in upgrade URLs.
+type WSTicket struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	TicketHash string    `gorm:"uniqueIndex;not null" json:"-"`
+	UserID     uint      `gorm:"not null;index" json:"user_id"`
+	CanWrite   bool      `gorm:"default:true" json:"can_write"`
+	ExpiresAt  time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (WSTicket) TableName() string {
+	return "ws_tickets"
+}
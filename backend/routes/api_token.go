@@ -0,0 +1,281 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"chat-backend/config"
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CreateAPITokenInput struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=365"` // 0 means no expiry
+}
+
+type CreateBotInput struct {
+	Username string `json:"username" binding:"required,min=3,max=50"`
+}
+
+// CreateAPIToken issues a personal access token for the current user.
+// The plaintext token is only returned once.
+func CreateAPIToken(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var input CreateAPITokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondWithNewAPIToken(c, user.ID, input)
+}
+
+// GetAPITokens lists the current user's personal access tokens.
+func GetAPITokens(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	listAPITokens(c, user.ID)
+}
+
+// DeleteAPIToken revokes a token belonging to the current user or one of their bots.
+func DeleteAPIToken(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	result := database.DB.
+		Where("id = ?", c.Param("id")).
+		Where("user_id = ? OR user_id IN (?)", user.ID,
+			database.DB.Model(&models.User{}).Select("id").Where("bot_owner_id = ?", user.ID)).
+		Delete(&models.PersonalAccessToken{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+// CreateBot creates a bot account owned by the current user. Bots cannot log
+// in with a password and authenticate with personal access tokens instead.
+func CreateBot(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var input CreateBotInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user.IsBot {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Bots cannot create bots"})
+		return
+	}
+
+	if isReservedUsername(input.Username) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username is reserved"})
+		return
+	}
+
+	email := strings.ToLower(input.Username) + "@bots.invalid"
+
+	var existingUser models.User
+	if err := database.DB.Where("email = ? OR username = ?", email, input.Username).First(&existingUser).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already taken"})
+		return
+	}
+
+	// The password is random and never revealed; Login also refuses bots outright
+	password, err := randomURLString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create bot"})
+		return
+	}
+
+	bot := models.User{
+		Username:   input.Username,
+		Email:      email,
+		Status:     "offline",
+		LastSeen:   time.Now(),
+		IsBot:      true,
+		BotOwnerID: &user.ID,
+	}
+	if err := bot.HashPassword(password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create bot"})
+		return
+	}
+
+	if err := database.DB.Create(&bot).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create bot"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"bot": bot})
+}
+
+// GetBots lists the bots owned by the current user.
+func GetBots(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var bots []models.User
+	if err := database.DB.Where("bot_owner_id = ?", user.ID).Order("created_at ASC").Find(&bots).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bots"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bots": bots})
+}
+
+// DeleteBot removes a bot account together with its tokens.
+func DeleteBot(c *gin.Context) {
+	bot, ok := findOwnedBot(c)
+	if !ok {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", bot.ID).Delete(&models.PersonalAccessToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&bot).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete bot"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bot deleted"})
+}
+
+// CreateBotToken issues a personal access token for one of the current user's bots.
+func CreateBotToken(c *gin.Context) {
+	bot, ok := findOwnedBot(c)
+	if !ok {
+		return
+	}
+
+	var input CreateAPITokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondWithNewAPIToken(c, bot.ID, input)
+}
+
+// GetBotTokens lists the tokens of one of the current user's bots.
+func GetBotTokens(c *gin.Context) {
+	bot, ok := findOwnedBot(c)
+	if !ok {
+		return
+	}
+
+	listAPITokens(c, bot.ID)
+}
+
+func findOwnedBot(c *gin.Context) (models.User, bool) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var bot models.User
+	err := database.DB.Where("id = ? AND is_bot = ? AND bot_owner_id = ?", c.Param("id"), true, user.ID).First(&bot).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Bot not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bot"})
+		}
+		return models.User{}, false
+	}
+
+	return bot, true
+}
+
+func respondWithNewAPIToken(c *gin.Context, userID uint, input CreateAPITokenInput) {
+	scopes := map[string]bool{}
+	for _, scope := range input.Scopes {
+		if !models.ValidScopes[scope] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope: " + scope})
+			return
+		}
+		scopes[scope] = true
+	}
+
+	scopeList := make([]string, 0, len(scopes))
+	for scope := range scopes {
+		scopeList = append(scopeList, scope)
+	}
+	sort.Strings(scopeList)
+
+	secret, err := randomURLString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	plaintext := models.PersonalAccessTokenPrefix + secret
+
+	pat := models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      input.Name,
+		TokenHash: config.HashToken(plaintext),
+		Prefix:    plaintext[:len(models.PersonalAccessTokenPrefix)+6],
+		Scopes:    strings.Join(scopeList, ","),
+	}
+	if input.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		pat.ExpiresAt = &expiresAt
+	}
+
+	if err := database.DB.Create(&pat).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	response := apiTokenResponse(pat)
+	response["token"] = plaintext
+	c.JSON(http.StatusCreated, response)
+}
+
+func listAPITokens(c *gin.Context, userID uint) {
+	var tokens []models.PersonalAccessToken
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tokens"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(tokens))
+	for _, token := range tokens {
+		response = append(response, apiTokenResponse(token))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": response})
+}
+
+func apiTokenResponse(token models.PersonalAccessToken) gin.H {
+	return gin.H{
+		"id":           token.ID,
+		"user_id":      token.UserID,
+		"name":         token.Name,
+		"prefix":       token.Prefix,
+		"scopes":       token.ScopeList(),
+		"last_used_at": token.LastUsedAt,
+		"expires_at":   token.ExpiresAt,
+		"created_at":   token.CreatedAt,
+	}
+}
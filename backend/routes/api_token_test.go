@@ -0,0 +1,107 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"chat-backend/config"
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// callHandler runs handler as user with a JSON body and optional path parameters.
+func callHandler(handler gin.HandlerFunc, user models.User, method, body string, params ...gin.Param) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(method, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+	c.Set("user", user)
+	handler(c)
+	return recorder
+}
+
+func TestCreateAPITokenStoresOnlyTheHash(t *testing.T) {
+	useTestDB(t)
+
+	user := createTestUser(t, "token_owner")
+	recorder := callHandler(CreateAPIToken, user, http.MethodPost,
+		`{"name": "ci", "scopes": ["messages:write", "messages:read", "messages:write"]}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("create token = %d %s, want %d", recorder.Code, recorder.Body, http.StatusCreated)
+	}
+
+	var body struct {
+		Token  string   `json:"token"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(body.Token, models.PersonalAccessTokenPrefix) {
+		t.Errorf("token %q lacks the %s prefix", body.Token, models.PersonalAccessTokenPrefix)
+	}
+	if strings.Join(body.Scopes, ",") != "messages:read,messages:write" {
+		t.Errorf("scopes = %v, want them deduplicated and sorted", body.Scopes)
+	}
+
+	var stored models.PersonalAccessToken
+	if err := database.DB.Where("user_id = ?", user.ID).First(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.TokenHash != config.HashToken(body.Token) || strings.Contains(stored.TokenHash, body.Token) {
+		t.Error("stored token is not the hash of the issued token")
+	}
+}
+
+func TestCreateAPITokenRejectsUnknownScope(t *testing.T) {
+	useTestDB(t)
+
+	user := createTestUser(t, "token_scope")
+	recorder := callHandler(CreateAPIToken, user, http.MethodPost, `{"name": "ci", "scopes": ["admin"]}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("unknown scope = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
+
+func TestBotsBelongToTheirOwner(t *testing.T) {
+	useTestDB(t)
+
+	owner := createTestUser(t, "bot_owner")
+	other := createTestUser(t, "bot_stranger")
+
+	recorder := callHandler(CreateBot, owner, http.MethodPost, `{"username": "helper_bot"}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("create bot = %d %s, want %d", recorder.Code, recorder.Body, http.StatusCreated)
+	}
+	var body struct {
+		Bot models.User `json:"bot"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	botID := gin.Param{Key: "id", Value: strconv.FormatUint(uint64(body.Bot.ID), 10)}
+
+	if recorder := callHandler(CreateBotToken, other, http.MethodPost, `{"name": "x", "scopes": ["messages:read"]}`, botID); recorder.Code != http.StatusNotFound {
+		t.Errorf("token for someone else's bot = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+	if recorder := callHandler(DeleteBot, other, http.MethodDelete, "", botID); recorder.Code != http.StatusNotFound {
+		t.Errorf("deleting someone else's bot = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+	if recorder := callHandler(CreateBotToken, owner, http.MethodPost, `{"name": "x", "scopes": ["messages:read"]}`, botID); recorder.Code != http.StatusCreated {
+		t.Errorf("token for own bot = %d %s, want %d", recorder.Code, recorder.Body, http.StatusCreated)
+	}
+
+	var bot models.User
+	database.DB.First(&bot, body.Bot.ID)
+	if recorder := callHandler(CreateBot, bot, http.MethodPost, `{"username": "sub_bot"}`); recorder.Code != http.StatusForbidden {
+		t.Errorf("bot creating a bot = %d, want %d", recorder.Code, http.StatusForbidden)
+	}
+}
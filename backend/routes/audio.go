@@ -0,0 +1,347 @@
+package routes
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// audioInfo is what can be learned about a voice note without decoding it:
+// the container's duration and the size of every compressed packet. Opus and
+// AAC voice recordings are variable bitrate, so louder passages take more
+// bytes and packet sizes make a serviceable loudness envelope.
+type audioInfo struct {
+	mimeType    string
+	extension   string
+	duration    time.Duration
+	packetSizes []int
+}
+
+var (
+	errUnsupportedAudio = errors.New("voice notes must be Opus (Ogg) or AAC (ADTS or M4A)")
+	errMalformedAudio   = errors.New("audio file is malformed")
+)
+
+var adtsSampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// probeAudio identifies the container from its magic bytes and reads it.
+func probeAudio(data []byte) (audioInfo, error) {
+	switch {
+	case len(data) >= 4 && string(data[:4]) == "OggS":
+		return probeOggOpus(data)
+	case len(data) >= 8 && string(data[4:8]) == "ftyp":
+		return probeMP4(data)
+	}
+
+	// Raw AAC files may start with an ID3 tag
+	if len(data) >= 10 && string(data[:3]) == "ID3" {
+		size := int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f)
+		if 10+size > len(data) {
+			return audioInfo{}, errMalformedAudio
+		}
+		data = data[10+size:]
+	}
+	if len(data) >= 2 && data[0] == 0xFF && data[1]&0xF6 == 0xF0 {
+		return probeADTS(data)
+	}
+
+	return audioInfo{}, errUnsupportedAudio
+}
+
+// probeOggOpus walks the Ogg pages of the first logical stream. The duration
+// is the last granule position (48 kHz samples) minus the encoder pre-skip.
+func probeOggOpus(data []byte) (audioInfo, error) {
+	info := audioInfo{mimeType: "audio/ogg", extension: "ogg"}
+
+	var serial uint32
+	var head []byte
+	packetIndex, packetSize, preSkip := 0, 0, 0
+	lastGranule := int64(-1)
+
+	for offset := 0; offset < len(data); {
+		if len(data)-offset < 27 || string(data[offset:offset+4]) != "OggS" {
+			return audioInfo{}, errMalformedAudio
+		}
+		granule := int64(binary.LittleEndian.Uint64(data[offset+6:]))
+		pageSerial := binary.LittleEndian.Uint32(data[offset+14:])
+		segments := int(data[offset+26])
+
+		bodyStart := offset + 27 + segments
+		if bodyStart > len(data) {
+			return audioInfo{}, errMalformedAudio
+		}
+		lacing := data[offset+27 : bodyStart]
+		bodySize := 0
+		for _, value := range lacing {
+			bodySize += int(value)
+		}
+		if bodyStart+bodySize > len(data) {
+			return audioInfo{}, errMalformedAudio
+		}
+
+		if offset == 0 {
+			serial = pageSerial
+		}
+		if pageSerial == serial {
+			position := bodyStart
+			for _, value := range lacing {
+				if packetIndex == 0 && len(head) < 64 {
+					head = append(head, data[position:position+int(value)]...)
+				}
+				packetSize += int(value)
+				position += int(value)
+
+				// A lacing value below 255 ends the packet
+				if value == 255 {
+					continue
+				}
+				switch packetIndex {
+				case 0:
+					if len(head) < 19 || string(head[:8]) != "OpusHead" {
+						return audioInfo{}, errUnsupportedAudio
+					}
+					preSkip = int(binary.LittleEndian.Uint16(head[10:12]))
+				case 1:
+					// OpusTags
+				default:
+					info.packetSizes = append(info.packetSizes, packetSize)
+				}
+				packetIndex++
+				packetSize = 0
+			}
+
+			// -1 marks a page on which no packet ends
+			if granule != -1 && packetIndex > 2 {
+				lastGranule = granule
+			}
+		}
+
+		offset = bodyStart + bodySize
+	}
+
+	if packetIndex == 0 {
+		return audioInfo{}, errUnsupportedAudio
+	}
+	if lastGranule < 0 {
+		return audioInfo{}, errMalformedAudio
+	}
+
+	duration, err := samplesDuration(max(lastGranule-int64(preSkip), 0), 48000)
+	if err != nil {
+		return audioInfo{}, err
+	}
+	info.duration = duration
+	return info, nil
+}
+
+// probeADTS walks raw AAC frames; each raw data block holds 1024 samples.
+func probeADTS(data []byte) (audioInfo, error) {
+	info := audioInfo{mimeType: "audio/aac", extension: "aac"}
+
+	var samples int64
+	sampleRate := 0
+	for offset := 0; offset+7 <= len(data); {
+		header := data[offset:]
+		if header[0] != 0xFF || header[1]&0xF6 != 0xF0 {
+			return audioInfo{}, errMalformedAudio
+		}
+
+		rateIndex := int(header[2]>>2) & 0x0F
+		if rateIndex >= len(adtsSampleRates) {
+			return audioInfo{}, errMalformedAudio
+		}
+		frameLength := int(header[3]&0x03)<<11 | int(header[4])<<3 | int(header[5]>>5)
+		if frameLength < 7 || offset+frameLength > len(data) {
+			return audioInfo{}, errMalformedAudio
+		}
+
+		sampleRate = adtsSampleRates[rateIndex]
+		samples += int64(header[6]&0x03+1) * 1024
+		info.packetSizes = append(info.packetSizes, frameLength)
+		offset += frameLength
+	}
+
+	if sampleRate == 0 {
+		return audioInfo{}, errMalformedAudio
+	}
+	duration, err := samplesDuration(samples, int64(sampleRate))
+	if err != nil {
+		return audioInfo{}, err
+	}
+	info.duration = duration
+	return info, nil
+}
+
+// samplesDuration converts a sample count into a duration, rejecting counts
+// too large for time.Duration.
+func samplesDuration(samples, sampleRate int64) (time.Duration, error) {
+	seconds := samples / sampleRate
+	if seconds >= int64(math.MaxInt64/time.Second) {
+		return 0, errMalformedAudio
+	}
+	remainder := time.Duration(samples%sampleRate) * time.Second / time.Duration(sampleRate)
+	return time.Duration(seconds)*time.Second + remainder, nil
+}
+
+// probeMP4 reads the first AAC sound track of an MP4/M4A file: the duration
+// from its mdhd box and the sample sizes from its stsz box.
+func probeMP4(data []byte) (audioInfo, error) {
+	info := audioInfo{mimeType: "audio/mp4", extension: "m4a"}
+
+	moov, err := findBox(data, "moov")
+	if err != nil {
+		return audioInfo{}, err
+	}
+
+	found := false
+	err = forEachBox(moov, func(boxType string, trak []byte) (bool, error) {
+		if boxType != "trak" {
+			return false, nil
+		}
+
+		hdlr, err := findBox(trak, "mdia", "hdlr")
+		if err != nil || len(hdlr) < 12 || string(hdlr[8:12]) != "soun" {
+			return false, nil
+		}
+		stsd, err := findBox(trak, "mdia", "minf", "stbl", "stsd")
+		if err != nil || len(stsd) < 16 || string(stsd[12:16]) != "mp4a" {
+			return false, errUnsupportedAudio
+		}
+
+		mdhd, err := findBox(trak, "mdia", "mdhd")
+		if err != nil {
+			return false, err
+		}
+		var timescale, duration uint64
+		switch {
+		case len(mdhd) >= 20 && mdhd[0] == 0:
+			timescale = uint64(binary.BigEndian.Uint32(mdhd[12:]))
+			duration = uint64(binary.BigEndian.Uint32(mdhd[16:]))
+		case len(mdhd) >= 32 && mdhd[0] == 1:
+			timescale = uint64(binary.BigEndian.Uint32(mdhd[20:]))
+			duration = binary.BigEndian.Uint64(mdhd[24:])
+		default:
+			return false, errMalformedAudio
+		}
+		if timescale == 0 || duration/timescale > uint64(math.MaxInt64/time.Second) {
+			return false, errMalformedAudio
+		}
+		info.duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+
+		stsz, err := findBox(trak, "mdia", "minf", "stbl", "stsz")
+		if err != nil || len(stsz) < 12 {
+			return false, errMalformedAudio
+		}
+		fixedSize := int(binary.BigEndian.Uint32(stsz[4:]))
+		count := int(binary.BigEndian.Uint32(stsz[8:]))
+		if fixedSize != 0 {
+			// Constant bitrate: no envelope to recover, but keep the count
+			count = min(count, 1<<20)
+			for range count {
+				info.packetSizes = append(info.packetSizes, fixedSize)
+			}
+		} else {
+			if count > (len(stsz)-12)/4 {
+				return false, errMalformedAudio
+			}
+			for i := range count {
+				info.packetSizes = append(info.packetSizes, int(binary.BigEndian.Uint32(stsz[12+4*i:])))
+			}
+		}
+
+		found = true
+		return true, nil
+	})
+	if err != nil {
+		return audioInfo{}, err
+	}
+	if !found {
+		return audioInfo{}, errUnsupportedAudio
+	}
+	return info, nil
+}
+
+// forEachBox calls fn with the type and body of every top-level box in data
+// until fn asks to stop.
+func forEachBox(data []byte, fn func(boxType string, body []byte) (bool, error)) error {
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return errMalformedAudio
+		}
+		size := uint64(binary.BigEndian.Uint32(data))
+		header := uint64(8)
+		switch size {
+		case 0: // Box runs to the end of its parent
+			size = uint64(len(data))
+		case 1: // 64-bit size follows the type
+			if len(data) < 16 {
+				return errMalformedAudio
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return errMalformedAudio
+		}
+
+		stop, err := fn(string(data[4:8]), data[header:size])
+		if err != nil || stop {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+// findBox returns the body of the first box along path.
+func findBox(data []byte, path ...string) ([]byte, error) {
+	for _, boxType := range path {
+		var found []byte
+		err := forEachBox(data, func(candidate string, body []byte) (bool, error) {
+			if candidate == boxType {
+				found = body
+				return true, nil
+			}
+			return false, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if found == nil {
+			return nil, errMalformedAudio
+		}
+		data = found
+	}
+	return data, nil
+}
+
+// waveform downsamples packet sizes into at most buckets values from 0 to
+// 100, relative to the loudest bucket.
+func waveform(packetSizes []int, buckets int) []int {
+	if len(packetSizes) == 0 {
+		return nil
+	}
+	buckets = min(buckets, len(packetSizes))
+
+	averages := make([]float64, buckets)
+	loudest := 0.0
+	for b := range averages {
+		start := b * len(packetSizes) / buckets
+		end := (b + 1) * len(packetSizes) / buckets
+		total := 0
+		for _, size := range packetSizes[start:end] {
+			total += size
+		}
+		averages[b] = float64(total) / float64(end-start)
+		loudest = max(loudest, averages[b])
+	}
+
+	values := make([]int, buckets)
+	for b, average := range averages {
+		if loudest > 0 {
+			values[b] = int(math.Round(average / loudest * 100))
+		}
+	}
+	return values
+}
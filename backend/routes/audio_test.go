@@ -0,0 +1,246 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// oggPage builds an Ogg page holding whole packets; CRCs are not checked.
+func oggPage(serial uint32, granule int64, packets ...[]byte) []byte {
+	var lacing, body []byte
+	for _, packet := range packets {
+		for n := len(packet); ; n -= 255 {
+			if n < 255 {
+				lacing = append(lacing, byte(n))
+				break
+			}
+			lacing = append(lacing, 255)
+		}
+		body = append(body, packet...)
+	}
+
+	page := make([]byte, 27, 27+len(lacing)+len(body))
+	copy(page, "OggS")
+	binary.LittleEndian.PutUint64(page[6:], uint64(granule))
+	binary.LittleEndian.PutUint32(page[14:], serial)
+	page[26] = byte(len(lacing))
+	return append(append(page, lacing...), body...)
+}
+
+func opusHead(preSkip uint16) []byte {
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8], head[9] = 1, 1 // Version, channels
+	binary.LittleEndian.PutUint16(head[10:], preSkip)
+	binary.LittleEndian.PutUint32(head[12:], 48000)
+	return head
+}
+
+// oggOpus builds a one-stream Opus file whose audio packets end at granule.
+func oggOpus(preSkip uint16, granule int64, packets ...[]byte) []byte {
+	return slices.Concat(
+		oggPage(1, 0, opusHead(preSkip)),
+		oggPage(1, 0, []byte("OpusTags")),
+		oggPage(1, granule, packets...),
+	)
+}
+
+// adtsFrame builds an AAC frame of size bytes at adtsSampleRates[rateIndex]
+// with one raw data block.
+func adtsFrame(rateIndex, size int) []byte {
+	frame := make([]byte, size)
+	frame[0], frame[1] = 0xFF, 0xF1
+	frame[2] = 1<<6 | byte(rateIndex)<<2
+	frame[3] = 1<<6 | byte(size>>11)&0x03
+	frame[4] = byte(size >> 3)
+	frame[5] = byte(size&0x07)<<5 | 0x1F
+	frame[6] = 0xFC
+	return frame
+}
+
+func mp4Box(boxType string, body ...[]byte) []byte {
+	content := slices.Concat(body...)
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(content)))
+	return append(append(box, boxType...), content...)
+}
+
+func be32(values ...uint32) []byte {
+	var out []byte
+	for _, value := range values {
+		out = binary.BigEndian.AppendUint32(out, value)
+	}
+	return out
+}
+
+// m4a builds an M4A file with one track of handler and codec. With a
+// sampleSize of 0 the track lists sizes; otherwise sizes[0] samples all have
+// sampleSize bytes.
+func m4a(handler, codec string, mdhd []byte, sampleSize uint32, sizes ...uint32) []byte {
+	stsz := be32(0, sampleSize, sizes[0])
+	if sampleSize == 0 {
+		stsz = slices.Concat(be32(0, 0, uint32(len(sizes))), be32(sizes...))
+	}
+	return slices.Concat(
+		mp4Box("ftyp", []byte("M4A "), be32(0)),
+		mp4Box("moov", mp4Box("trak", mp4Box("mdia",
+			mp4Box("hdlr", be32(0, 0), []byte(handler)),
+			mp4Box("mdhd", mdhd),
+			mp4Box("minf", mp4Box("stbl",
+				mp4Box("stsd", be32(0, 1, 16), []byte(codec)),
+				mp4Box("stsz", stsz),
+			)),
+		))),
+	)
+}
+
+// mdhdV0 is a version 0 media header body.
+func mdhdV0(timescale, duration uint32) []byte {
+	return be32(0, 0, 0, timescale, duration, 0)
+}
+
+func TestProbeOggOpus(t *testing.T) {
+	long := bytes.Repeat([]byte{1}, 300) // Spans two lacing values
+	info, err := probeOggOpus(oggOpus(312, 312+72000, []byte("0123456789"), long))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.mimeType != "audio/ogg" || info.duration != 1500*time.Millisecond || !slices.Equal(info.packetSizes, []int{10, 300}) {
+		t.Errorf("probeOggOpus = %+v, want 1.5s with packets of 10 and 300 bytes", info)
+	}
+
+	// Pages of other logical streams are skipped
+	other := slices.Concat(oggOpus(0, 48000, []byte("a")), oggPage(2, 96000*48000, []byte("video")))
+	if info, err := probeOggOpus(other); err != nil || info.duration != time.Second {
+		t.Errorf("probeOggOpus with a second stream = %+v, %v; want 1s", info, err)
+	}
+
+	if info, err := probeOggOpus(oggOpus(500, 100, []byte("a"))); err != nil || info.duration != 0 {
+		t.Errorf("probeOggOpus with pre-skip past the end = %+v, %v; want 0s", info, err)
+	}
+
+	valid := oggOpus(0, 48000, []byte("a"))
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"truncated body", valid[:len(valid)-1], errMalformedAudio},
+		{"truncated header", valid[:20], errMalformedAudio},
+		{"no audio packets", oggOpus(0, 48000)[:len(oggPage(1, 0, opusHead(0)))], errMalformedAudio},
+		{"not Opus", oggPage(1, 0, []byte("\x01vorbis and some more bytes")), errUnsupportedAudio},
+		{"duration overflows", oggOpus(0, math.MaxInt64, []byte("a")), errMalformedAudio},
+	}
+	for _, tt := range tests {
+		if _, err := probeOggOpus(tt.data); !errors.Is(err, tt.err) {
+			t.Errorf("probeOggOpus(%s) = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestProbeADTS(t *testing.T) {
+	data := slices.Concat(adtsFrame(3, 20), adtsFrame(3, 30), adtsFrame(3, 25))
+	info, err := probeADTS(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.mimeType != "audio/aac" || info.duration != 64*time.Millisecond || !slices.Equal(info.packetSizes, []int{20, 30, 25}) {
+		t.Errorf("probeADTS = %+v, want 64ms with frames of 20, 30 and 25 bytes", info)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated frame", data[:len(data)-1]},
+		{"bad sync word", append(adtsFrame(3, 20), 0, 0, 0, 0, 0, 0, 0)},
+		{"reserved sample rate", adtsFrame(13, 20)},
+		{"shorter than a header", adtsFrame(3, 7)[:6]},
+	}
+	for _, tt := range tests {
+		if _, err := probeADTS(tt.data); !errors.Is(err, errMalformedAudio) {
+			t.Errorf("probeADTS(%s) = %v, want %v", tt.name, err, errMalformedAudio)
+		}
+	}
+}
+
+func TestProbeMP4(t *testing.T) {
+	info, err := probeMP4(m4a("soun", "mp4a", mdhdV0(44100, 88200), 0, 100, 200, 150))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.mimeType != "audio/mp4" || info.duration != 2*time.Second || !slices.Equal(info.packetSizes, []int{100, 200, 150}) {
+		t.Errorf("probeMP4 = %+v, want 2s with samples of 100, 200 and 150 bytes", info)
+	}
+
+	if info, err := probeMP4(m4a("soun", "mp4a", mdhdV0(1000, 500), 64, 3)); err != nil || !slices.Equal(info.packetSizes, []int{64, 64, 64}) {
+		t.Errorf("probeMP4 with fixed sample size = %+v, %v; want three samples of 64 bytes", info, err)
+	}
+
+	mdhdV1 := slices.Concat(be32(1<<24, 0, 0, 0, 0, 1), binary.BigEndian.AppendUint64(nil, math.MaxUint64), be32(0))
+	valid := m4a("soun", "mp4a", mdhdV0(44100, 88200), 0, 100)
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"video only", m4a("vide", "avc1", mdhdV0(1000, 1000), 0, 100), errUnsupportedAudio},
+		{"not AAC", m4a("soun", "Opus", mdhdV0(1000, 1000), 0, 100), errUnsupportedAudio},
+		{"no moov", mp4Box("ftyp", []byte("M4A "), be32(0)), errMalformedAudio},
+		{"truncated", valid[:len(valid)-3], errMalformedAudio},
+		{"zero timescale", m4a("soun", "mp4a", mdhdV0(0, 1000), 0, 100), errMalformedAudio},
+		{"duration overflows", m4a("soun", "mp4a", mdhdV1, 0, 100), errMalformedAudio},
+	}
+	for _, tt := range tests {
+		if _, err := probeMP4(tt.data); !errors.Is(err, tt.err) {
+			t.Errorf("probeMP4(%s) = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestProbeAudioDetectsContainers(t *testing.T) {
+	id3 := append([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 5, 0, 0, 0, 0, 0}, adtsFrame(3, 20)...)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		mimeType string
+		err      error
+	}{
+		{"Ogg", oggOpus(0, 48000, []byte("a")), "audio/ogg", nil},
+		{"ADTS", adtsFrame(4, 30), "audio/aac", nil},
+		{"ADTS after ID3", id3, "audio/aac", nil},
+		{"M4A", m4a("soun", "mp4a", mdhdV0(1000, 1000), 0, 100), "audio/mp4", nil},
+		{"ID3 past the end", id3[:12], "", errMalformedAudio},
+		{"WAV", []byte("RIFF\x00\x00\x00\x00WAVEfmt "), "", errUnsupportedAudio},
+		{"empty", nil, "", errUnsupportedAudio},
+	}
+	for _, tt := range tests {
+		info, err := probeAudio(tt.data)
+		if !errors.Is(err, tt.err) || info.mimeType != tt.mimeType {
+			t.Errorf("probeAudio(%s) = %q, %v; want %q, %v", tt.name, info.mimeType, err, tt.mimeType, tt.err)
+		}
+	}
+}
+
+func TestWaveform(t *testing.T) {
+	tests := []struct {
+		sizes   []int
+		buckets int
+		want    []int
+	}{
+		{nil, 10, nil},
+		{[]int{10, 20, 30, 40}, 2, []int{43, 100}},
+		{[]int{5, 10, 5}, 10, []int{50, 100, 50}},
+		{[]int{0, 0}, 2, []int{0, 0}},
+	}
+	for _, tt := range tests {
+		if got := waveform(tt.sizes, tt.buckets); !slices.Equal(got, tt.want) {
+			t.Errorf("waveform(%v, %d) = %v, want %v", tt.sizes, tt.buckets, got, tt.want)
+		}
+	}
+}
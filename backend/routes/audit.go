@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"log"
+
+	"chat-backend/database"
+	"chat-backend/models"
+)
+
+// recordAuditEvent persists a security event and mirrors it to the server log.
+func recordAuditEvent(event string, userID *uint, ip, details string) {
+	log.Printf("AUDIT %s user=%v ip=%s %s", event, formatUserID(userID), ip, details)
+
+	entry := models.AuditLog{
+		Event:   event,
+		UserID:  userID,
+		IP:      ip,
+		Details: details,
+	}
+	if err := database.DB.Create(&entry).Error; err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+func formatUserID(userID *uint) interface{} {
+	if userID == nil {
+		return "-"
+	}
+	return *userID
+}
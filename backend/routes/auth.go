@@ -1,10 +1,12 @@
 package routes
 
 import (
+	"math"
 	"net/http"
-	"os"
+	"strconv"
 	"time"
 
+	"chat-backend/config"
 	"chat-backend/database"
 	"chat-backend/models"
 
@@ -31,6 +33,16 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	if err := config.ValidatePassword(input.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if isReservedUsername(input.Username) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username is reserved"})
+		return
+	}
+
 	var existingUser models.User
 	if err := database.DB.Where("email = ? OR username = ?", input.Email, input.Username).First(&existingUser).Error; err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
@@ -62,7 +74,7 @@ func Register(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"user":  user,
+		"user":  ownProfile(user),
 		"token": token,
 	})
 }
@@ -74,17 +86,54 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// Count the attempt before touching bcrypt, refusing if this IP or
+	// account is backing off
+	attempt, wait := getLoginThrottle().reserve(c.ClientIP(), input.Email)
+	if wait > 0 {
+		abortTooManyAttempts(c, wait)
+		return
+	}
+
 	var user models.User
 	if err := database.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		attempt.fail(nil)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	// Bots authenticate with personal access tokens only
+	if user.IsBot {
+		attempt.release()
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
 	if err := user.CheckPassword(input.Password); err != nil {
+		attempt.fail(&user.ID)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
+	// With 2FA enabled, the password only earns a challenge token that must be
+	// exchanged at /auth/login/2fa together with a TOTP or backup code, which
+	// is throttled on its own
+	if user.TwoFactorEnabled {
+		attempt.release()
+		challengeToken, err := generateChallengeToken(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challengeToken,
+		})
+		return
+	}
+
+	attempt.succeed(user.ID)
+
 	token, err := generateToken(user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
@@ -92,24 +141,34 @@ func Login(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"user":  user,
+		"user":  ownProfile(user),
 		"token": token,
 	})
 }
 
+// abortTooManyAttempts responds with 429 and a Retry-After header in whole seconds.
+func abortTooManyAttempts(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many login attempts, please try again later",
+		"retry_after": seconds,
+	})
+}
+
 func generateToken(userID uint) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "your-secret-key-change-in-production"
-	}
+	return issueToken(userID, time.Now())
+}
 
+// issueToken signs an access token dated issuedAt.
+func issueToken(userID uint, issuedAt time.Time) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
+		"iat":     issuedAt.Unix(),
+		"exp":     issuedAt.Add(time.Hour * 24 * 7).Unix(), // 7 days
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return config.SignToken(claims, config.AccessTokenAudience)
 }
 
 func Logout(c *gin.Context) {
@@ -124,25 +183,12 @@ func Logout(c *gin.Context) {
 	}
 
 	// Parse token to get expiration
-	token, err := jwt.Parse(tokenString.(string), func(token *jwt.Token) (interface{}, error) {
-		secret := os.Getenv("JWT_SECRET")
-		if secret == "" {
-			secret = "your-secret-key-change-in-production"
-		}
-		return []byte(secret), nil
-	})
-
+	claims, err := config.ParseToken(tokenString.(string), config.AccessTokenAudience)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token"})
 		return
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token claims"})
-		return
-	}
-
 	expiresAt := time.Unix(int64(claims["exp"].(float64)), 0)
 
 	// Add token to blacklist
@@ -163,3 +209,10 @@ func Logout(c *gin.Context) {
 		"message": "Logged out successfully",
 	})
 }
+
+// GetJWKS publishes the token verification keys so other services can
+// validate chat tokens without sharing a secret.
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, config.JWKS())
+}
@@ -0,0 +1,171 @@
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // register GIF decoder
+	"image/jpeg"
+	_ "image/png" // register PNG decoder
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	avatarSize      = 256
+	avatarMaxBytes  = 5 << 20 // 5 MB
+	avatarMaxPixels = 4096 * 4096
+	avatarURLPrefix = "/uploads/avatars/"
+)
+
+// UploadDir returns where uploaded files are stored (UPLOAD_DIR, default ./uploads).
+func UploadDir() string {
+	dir := os.Getenv("UPLOAD_DIR")
+	if dir == "" {
+		dir = "uploads"
+	}
+	return dir
+}
+
+// processAvatar decodes an uploaded image, crops it to a centered square and
+// scales it down to avatarSize, returning the re-encoded JPEG path relative to
+// the avatars directory. Re-encoding also strips any metadata from the upload.
+func processAvatar(src io.Reader, userID uint) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(src, avatarMaxBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > avatarMaxBytes {
+		return "", errors.New("image is too large")
+	}
+
+	// Check dimensions before decoding to avoid decompression bombs
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", errors.New("unsupported image format")
+	}
+	if config.Width*config.Height > avatarMaxPixels {
+		return "", errors.New("image dimensions are too large")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", errors.New("unsupported image format")
+	}
+
+	resized := resizeSquare(img, avatarSize)
+
+	dir := filepath.Join(UploadDir(), "avatars")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	suffix, err := randomURLString(8)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%d-%s.jpg", userID, suffix)
+
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if err := jpeg.Encode(file, resized, &jpeg.Options{Quality: 85}); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return name, nil
+}
+
+// removeAvatarFile deletes a previously uploaded avatar. URLs that were not
+// produced by processAvatar are ignored.
+func removeAvatarFile(avatarURL string) {
+	if !strings.HasPrefix(avatarURL, avatarURLPrefix) {
+		return
+	}
+	name := filepath.Base(strings.TrimPrefix(avatarURL, avatarURLPrefix))
+	os.Remove(filepath.Join(UploadDir(), "avatars", name))
+}
+
+// resizeSquare center-crops img to a square, flattens it onto white and
+// box-filters it down to size×size.
+func resizeSquare(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	origin := image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+
+	square := flattenOnWhite(img, image.Rectangle{Min: origin, Max: origin.Add(image.Pt(side, side))})
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := range size {
+		y0 := y * side / size
+		y1 := max((y+1)*side/size, y0+1)
+
+		for x := range size {
+			x0 := x * side / size
+			x1 := max((x+1)*side/size, x0+1)
+
+			var r, g, b, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := square.Pix[sy*square.Stride+x0*4 : sy*square.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint32(row[i])
+					g += uint32(row[i+1])
+					b += uint32(row[i+2])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = 255
+		}
+	}
+
+	return dst
+}
+
+// flattenOnWhite copies the area rect of img into an opaque RGBA buffer,
+// compositing over white so transparent PNGs do not turn black in the JPEG.
+// image/draw has fast paths for the types the JPEG and PNG decoders return;
+// GIF frames are paletted and handled here, so no pixel goes through At.
+func flattenOnWhite(img image.Image, rect image.Rectangle) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+
+	paletted, ok := img.(*image.Paletted)
+	if !ok {
+		draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Over)
+		return dst
+	}
+
+	// Composite each palette entry over white once instead of every pixel.
+	// Indexes past the palette are left white.
+	var palette [256][4]uint8
+	for i := range palette {
+		palette[i] = [4]uint8{255, 255, 255, 255}
+	}
+	for i, c := range paletted.Palette[:min(len(paletted.Palette), 256)] {
+		r, g, b, a := c.RGBA()
+		over := func(v uint32) uint8 { return uint8((v + 0xffff - a) >> 8) }
+		palette[i] = [4]uint8{over(r), over(g), over(b), 255}
+	}
+
+	for y := range rect.Dy() {
+		src := paletted.Pix[paletted.PixOffset(rect.Min.X, rect.Min.Y+y):][:rect.Dx()]
+		row := dst.Pix[y*dst.Stride:]
+		for x, index := range src {
+			copy(row[x*4:x*4+4], palette[index][:])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestProcessAvatarRejectsOversizedDimensions(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4097, 4096))); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := processAvatar(&buf, 1); err == nil || err.Error() != "image dimensions are too large" {
+		t.Fatalf("processAvatar error = %v, want the dimension limit", err)
+	}
+}
+
+func TestResizeSquareImageTypes(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	white := color.RGBA{255, 255, 255, 255}
+
+	// Left half red, right half transparent, on a canvas wider than tall so
+	// the crop keeps the middle
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 16, 8))
+	paletted := image.NewPaletted(image.Rect(0, 0, 16, 8), color.Palette{color.Transparent, red})
+	for y := range 8 {
+		for x := 4; x < 8; x++ {
+			nrgba.Set(x, y, red)
+			paletted.SetColorIndex(x, y, 1)
+		}
+	}
+
+	ycbcr := image.NewYCbCr(image.Rect(0, 0, 8, 8), image.YCbCrSubsampleRatio444)
+	for i := range ycbcr.Y {
+		ycbcr.Y[i], ycbcr.Cb[i], ycbcr.Cr[i] = color.RGBToYCbCr(255, 0, 0)
+	}
+
+	tests := []struct {
+		name        string
+		img         image.Image
+		left, right color.RGBA
+	}{
+		{"nrgba", nrgba, red, white},
+		{"paletted", paletted, red, white},
+		{"ycbcr", ycbcr, red, red},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := resizeSquare(tt.img, 4)
+			if out.Bounds() != image.Rect(0, 0, 4, 4) {
+				t.Fatalf("bounds = %v, want 4x4", out.Bounds())
+			}
+			if got := out.RGBAAt(0, 2); !near(got, tt.left) {
+				t.Errorf("left pixel = %v, want %v", got, tt.left)
+			}
+			if got := out.RGBAAt(3, 2); !near(got, tt.right) {
+				t.Errorf("right pixel = %v, want %v", got, tt.right)
+			}
+		})
+	}
+}
+
+// near allows for YCbCr rounding.
+func near(a, b color.RGBA) bool {
+	diff := func(x, y uint8) bool { return max(x, y)-min(x, y) <= 2 }
+	return diff(a.R, b.R) && diff(a.G, b.G) && diff(a.B, b.B) && a.A == b.A
+}
@@ -0,0 +1,134 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type BlockUserInput struct {
+	UserID uint `json:"user_id" binding:"required"`
+}
+
+// BlockUser blocks another user. Blocked users cannot start or continue a
+// direct conversation with the blocker, their group messages are hidden from
+// the blocker, and they no longer see the blocker's presence.
+func BlockUser(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var input BlockUserInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.UserID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot block yourself"})
+		return
+	}
+
+	var target models.User
+	if err := database.DB.First(&target, input.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Blocking also ends the friendship and any pending request between the two
+	block := models.UserBlock{BlockerID: user.ID, BlockedID: target.ID}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&block).Error; err != nil {
+			return err
+		}
+		if err := removeContacts(tx, user.ID, target.ID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.FriendRequest{}).
+			Where("status = ?", models.FriendRequestPending).
+			Where("(sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)", user.ID, target.ID, target.ID, user.ID).
+			Updates(map[string]interface{}{"status": models.FriendRequestCancelled, "responded_at": time.Now()}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User blocked"})
+}
+
+// UnblockUser removes a block.
+func UnblockUser(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	blockedID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	result := database.DB.Where("blocker_id = ? AND blocked_id = ?", user.ID, blockedID).Delete(&models.UserBlock{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unblock user"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not blocked"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unblocked"})
+}
+
+// GetBlockedUsers lists the users the current user has blocked.
+func GetBlockedUsers(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var blocks []models.UserBlock
+	if err := database.DB.
+		Where("blocker_id = ?", user.ID).
+		Preload("Blocked").
+		Order("created_at DESC").
+		Find(&blocks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blocked users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"blocks": blocks})
+}
+
+// blockedUserIDs returns the users that userID has blocked.
+func blockedUserIDs(userID uint) map[uint]bool {
+	var ids []uint
+	database.DB.Model(&models.UserBlock{}).Where("blocker_id = ?", userID).Pluck("blocked_id", &ids)
+	return idSet(ids)
+}
+
+// blockerIDsOf returns the users who have blocked userID.
+func blockerIDsOf(userID uint) map[uint]bool {
+	var ids []uint
+	database.DB.Model(&models.UserBlock{}).Where("blocked_id = ?", userID).Pluck("blocker_id", &ids)
+	return idSet(ids)
+}
+
+// isBlockedEitherWay reports whether a and b have blocked each other in either direction.
+func isBlockedEitherWay(a, b uint) bool {
+	var count int64
+	database.DB.Model(&models.UserBlock{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", a, b, b, a).
+		Count(&count)
+	return count > 0
+}
+
+// blockedSenderSubquery selects the users viewerID has blocked, for hiding their messages.
+func blockedSenderSubquery(viewerID uint) *gorm.DB {
+	return database.DB.Model(&models.UserBlock{}).Select("blocked_id").Where("blocker_id = ?", viewerID)
+}
@@ -0,0 +1,159 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"chat-backend/database"
+	"chat-backend/models"
+)
+
+func createTestConversation(t *testing.T, conversationType models.ConversationType, creator models.User, others ...models.User) models.Conversation {
+	t.Helper()
+
+	conversation := models.Conversation{
+		Type:         conversationType,
+		CreatedBy:    creator.ID,
+		Participants: append([]models.User{creator}, others...),
+	}
+	if err := database.DB.Create(&conversation).Error; err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	return conversation
+}
+
+func createTestMessage(t *testing.T, conversation models.Conversation, sender models.User, content string) models.Message {
+	t.Helper()
+
+	message := models.Message{
+		ConversationID: conversation.ID,
+		SenderID:       sender.ID,
+		Content:        content,
+		Type:           models.TextMessage,
+		Status:         models.MessageSent,
+	}
+	if err := database.DB.Create(&message).Error; err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+	return message
+}
+
+// visibleMessageIDs lists the messages of conversation that viewerID can see.
+func visibleMessageIDs(viewerID uint, conversation models.Conversation) map[uint]bool {
+	var ids []uint
+	database.DB.Model(&models.Message{}).
+		Scopes(visibleMessages(viewerID)).
+		Where("messages.conversation_id = ?", conversation.ID).
+		Pluck("messages.id", &ids)
+	return idSet(ids)
+}
+
+func TestCheckCanPostAppliesBlocksToDirectConversations(t *testing.T) {
+	useTestDB(t)
+
+	alice := createTestUser(t, "post_alice")
+	bob := createTestUser(t, "post_bob")
+	carol := createTestUser(t, "post_carol")
+	database.DB.Create(&models.UserBlock{BlockerID: alice.ID, BlockedID: bob.ID})
+
+	direct := createTestConversation(t, models.DirectMessage, alice, bob)
+	group := createTestConversation(t, models.GroupChat, alice, bob, carol)
+
+	tests := []struct {
+		name         string
+		sender       models.User
+		conversation models.Conversation
+		status       int // 0 when posting is allowed
+	}{
+		{"blocked user in direct conversation", bob, direct, http.StatusForbidden},
+		{"blocker in direct conversation", alice, direct, http.StatusForbidden},
+		{"blocked user in group", bob, group, 0},
+		{"non-participant", carol, direct, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var conversation models.Conversation
+			database.DB.Preload("Participants").First(&conversation, tt.conversation.ID)
+
+			err := checkCanPost(tt.sender.ID, conversation)
+			var actionErr *actionError
+			switch {
+			case tt.status == 0 && err != nil:
+				t.Errorf("checkCanPost = %v, want allowed", err)
+			case tt.status != 0 && (!errors.As(err, &actionErr) || actionErr.status != tt.status):
+				t.Errorf("checkCanPost = %v, want status %d", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestVisibleMessagesHidesBlockedSenders(t *testing.T) {
+	useTestDB(t)
+
+	alice := createTestUser(t, "visible_alice")
+	bob := createTestUser(t, "visible_bob")
+	carol := createTestUser(t, "visible_carol")
+	outsider := createTestUser(t, "visible_outsider")
+	database.DB.Create(&models.UserBlock{BlockerID: alice.ID, BlockedID: bob.ID})
+
+	group := createTestConversation(t, models.GroupChat, alice, bob, carol)
+	fromBob := createTestMessage(t, group, bob, "from bob")
+	fromCarol := createTestMessage(t, group, carol, "from carol")
+
+	tests := []struct {
+		viewer models.User
+		want   []uint
+	}{
+		{alice, []uint{fromCarol.ID}},
+		{carol, []uint{fromBob.ID, fromCarol.ID}},
+		{bob, []uint{fromBob.ID, fromCarol.ID}},
+		{outsider, nil},
+	}
+
+	for _, tt := range tests {
+		got := sortedIDs(visibleMessageIDs(tt.viewer.ID, group))
+		if !slices.Equal(got, sortedIDs(idSet(tt.want))) {
+			t.Errorf("%s sees messages %v, want %v", tt.viewer.Username, got, tt.want)
+		}
+	}
+}
+
+func TestBlockUserEndsFriendship(t *testing.T) {
+	useTestDB(t)
+
+	alice := createTestUser(t, "blocker_alice")
+	bob := createTestUser(t, "blocked_bob")
+	database.DB.Create(&[]models.Contact{
+		{UserID: alice.ID, ContactID: bob.ID},
+		{UserID: bob.ID, ContactID: alice.ID},
+	})
+	request := models.FriendRequest{SenderID: bob.ID, RecipientID: alice.ID}
+	database.DB.Create(&request)
+
+	recorder := callHandler(BlockUser, alice, http.MethodPost, fmt.Sprintf(`{"user_id": %d}`, bob.ID))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("block = %d %s, want %d", recorder.Code, recorder.Body, http.StatusOK)
+	}
+
+	if areContacts(alice.ID, bob.ID) || areContacts(bob.ID, alice.ID) {
+		t.Error("contacts survived the block")
+	}
+	database.DB.First(&request, request.ID)
+	if request.Status != models.FriendRequestCancelled {
+		t.Errorf("pending request status = %s, want cancelled", request.Status)
+	}
+
+	if recorder := callHandler(BlockUser, alice, http.MethodPost, fmt.Sprintf(`{"user_id": %d}`, alice.ID)); recorder.Code != http.StatusBadRequest {
+		t.Errorf("blocking yourself = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
+
+func sortedIDs(set map[uint]bool) []uint {
+	ids := mapKeys(set)
+	slices.Sort(ids)
+	return ids
+}
@@ -0,0 +1,323 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SendFriendRequestInput struct {
+	UserID uint `json:"user_id" binding:"required"`
+}
+
+// friendRequestView is a friend request with both users reduced to their
+// public profiles, since each side sees the other's.
+type friendRequestView struct {
+	models.FriendRequest
+	Sender    publicUser `json:"sender"`
+	Recipient publicUser `json:"recipient"`
+}
+
+func newFriendRequestView(request models.FriendRequest) friendRequestView {
+	return friendRequestView{
+		FriendRequest: request,
+		Sender:        newPublicUser(request.Sender),
+		Recipient:     newPublicUser(request.Recipient),
+	}
+}
+
+// SendFriendRequest asks another user to become a contact. If that user has
+// already sent a pending request the other way, both become contacts at once.
+func SendFriendRequest(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var input SendFriendRequestInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.UserID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot add yourself"})
+		return
+	}
+
+	var recipient models.User
+	if err := database.DB.First(&recipient, input.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if isBlockedEitherWay(user.ID, recipient.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot add this user"})
+		return
+	}
+
+	if areContacts(user.ID, recipient.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Already in your contacts"})
+		return
+	}
+
+	// A pending request in the opposite direction is treated as mutual consent
+	var reverse models.FriendRequest
+	err := database.DB.Where("sender_id = ? AND recipient_id = ? AND status = ?",
+		recipient.ID, user.ID, models.FriendRequestPending).
+		Preload("Sender").
+		Preload("Recipient").
+		First(&reverse).Error
+	if err == nil {
+		if err := acceptFriendRequest(&reverse); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add contact"})
+			return
+		}
+		notifyFriendRequest(hub, "friend_request_accepted", reverse, reverse.SenderID)
+		c.JSON(http.StatusOK, gin.H{"friend_request": newFriendRequestView(reverse)})
+		return
+	}
+
+	request := models.FriendRequest{
+		SenderID:    user.ID,
+		RecipientID: recipient.ID,
+		Status:      models.FriendRequestPending,
+	}
+	if err := database.DB.Create(&request).Error; err != nil {
+		// The partial unique index rejects a second pending request
+		c.JSON(http.StatusConflict, gin.H{"error": "Friend request already sent"})
+		return
+	}
+
+	database.DB.Preload("Sender").Preload("Recipient").First(&request, request.ID)
+	notifyFriendRequest(hub, "friend_request_received", request, request.RecipientID)
+
+	c.JSON(http.StatusCreated, gin.H{"friend_request": newFriendRequestView(request)})
+}
+
+// GetFriendRequests lists pending requests. ?direction=outgoing lists the ones
+// the current user sent; the default is incoming.
+func GetFriendRequests(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	query := database.DB.Where("status = ?", models.FriendRequestPending)
+	if c.Query("direction") == "outgoing" {
+		query = query.Where("sender_id = ?", user.ID)
+	} else {
+		query = query.Where("recipient_id = ?", user.ID)
+	}
+
+	var requests []models.FriendRequest
+	if err := query.Preload("Sender").Preload("Recipient").Order("created_at DESC").Find(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch friend requests"})
+		return
+	}
+
+	views := make([]friendRequestView, len(requests))
+	for i := range requests {
+		views[i] = newFriendRequestView(requests[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{"friend_requests": views})
+}
+
+// AcceptFriendRequest accepts a pending request sent to the current user.
+func AcceptFriendRequest(hub *Hub, c *gin.Context) {
+	request, ok := findPendingFriendRequest(c, "recipient_id")
+	if !ok {
+		return
+	}
+
+	if isBlockedEitherWay(request.SenderID, request.RecipientID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot add this user"})
+		return
+	}
+
+	if err := acceptFriendRequest(&request); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept friend request"})
+		return
+	}
+
+	notifyFriendRequest(hub, "friend_request_accepted", request, request.SenderID)
+	c.JSON(http.StatusOK, gin.H{"friend_request": newFriendRequestView(request)})
+}
+
+// DeclineFriendRequest declines a pending request sent to the current user.
+func DeclineFriendRequest(hub *Hub, c *gin.Context) {
+	request, ok := findPendingFriendRequest(c, "recipient_id")
+	if !ok {
+		return
+	}
+
+	if err := closeFriendRequest(&request, models.FriendRequestDeclined); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decline friend request"})
+		return
+	}
+
+	notifyFriendRequest(hub, "friend_request_declined", request, request.SenderID)
+	c.JSON(http.StatusOK, gin.H{"friend_request": newFriendRequestView(request)})
+}
+
+// CancelFriendRequest withdraws a pending request the current user sent.
+func CancelFriendRequest(hub *Hub, c *gin.Context) {
+	request, ok := findPendingFriendRequest(c, "sender_id")
+	if !ok {
+		return
+	}
+
+	if err := closeFriendRequest(&request, models.FriendRequestCancelled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel friend request"})
+		return
+	}
+
+	notifyFriendRequest(hub, "friend_request_cancelled", request, request.RecipientID)
+	c.JSON(http.StatusOK, gin.H{"friend_request": newFriendRequestView(request)})
+}
+
+// GetContacts lists the current user's contacts.
+func GetContacts(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var contacts []models.Contact
+	if err := database.DB.
+		Where("user_id = ?", user.ID).
+		Preload("Contact").
+		Order("created_at DESC").
+		Find(&contacts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch contacts"})
+		return
+	}
+
+	users := make([]models.User, len(contacts))
+	for i := range contacts {
+		users[i] = contacts[i].Contact
+	}
+	maskPresence(users, user.ID)
+
+	c.JSON(http.StatusOK, gin.H{"contacts": users})
+}
+
+// RemoveContact removes a contact in both directions.
+func RemoveContact(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var contact models.User
+	if err := database.DB.First(&contact, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	result := removeContacts(database.DB, user.ID, contact.ID)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove contact"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not in your contacts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Contact removed"})
+}
+
+func findPendingFriendRequest(c *gin.Context, ownerColumn string) (models.FriendRequest, bool) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var request models.FriendRequest
+	err := database.DB.
+		Where("id = ? AND status = ? AND "+ownerColumn+" = ?", c.Param("id"), models.FriendRequestPending, user.ID).
+		Preload("Sender").
+		Preload("Recipient").
+		First(&request).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Friend request not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch friend request"})
+		}
+		return models.FriendRequest{}, false
+	}
+
+	return request, true
+}
+
+func acceptFriendRequest(request *models.FriendRequest) error {
+	now := time.Now()
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(request).Updates(map[string]interface{}{
+			"status":       models.FriendRequestAccepted,
+			"responded_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		contacts := []models.Contact{
+			{UserID: request.SenderID, ContactID: request.RecipientID},
+			{UserID: request.RecipientID, ContactID: request.SenderID},
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&contacts).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	request.Status = models.FriendRequestAccepted
+	request.RespondedAt = &now
+	return nil
+}
+
+func closeFriendRequest(request *models.FriendRequest, status models.FriendRequestStatus) error {
+	now := time.Now()
+	if err := database.DB.Model(request).Updates(map[string]interface{}{
+		"status":       status,
+		"responded_at": now,
+	}).Error; err != nil {
+		return err
+	}
+
+	request.Status = status
+	request.RespondedAt = &now
+	return nil
+}
+
+func notifyFriendRequest(hub *Hub, eventType string, request models.FriendRequest, recipientID uint) {
+	hub.SendToUsers([]uint{recipientID}, map[string]interface{}{
+		"type":           eventType,
+		"friend_request": newFriendRequestView(request),
+	})
+}
+
+// removeContacts deletes the friendship between a and b in both directions.
+func removeContacts(tx *gorm.DB, a, b uint) *gorm.DB {
+	return tx.Where("(user_id = ? AND contact_id = ?) OR (user_id = ? AND contact_id = ?)", a, b, b, a).
+		Delete(&models.Contact{})
+}
+
+func areContacts(a, b uint) bool {
+	var count int64
+	database.DB.Model(&models.Contact{}).Where("user_id = ? AND contact_id = ?", a, b).Count(&count)
+	return count > 0
+}
+
+// directMessagesContactsOnly reports whether DIRECT_MESSAGES_CONTACTS_ONLY is
+// enabled, restricting new direct conversations to mutual contacts.
+func directMessagesContactsOnly() bool {
+	return os.Getenv("DIRECT_MESSAGES_CONTACTS_ONLY") == "true"
+}
+
+// contactIDsOf returns the contacts of userID.
+func contactIDsOf(userID uint) map[uint]bool {
+	var ids []uint
+	database.DB.Model(&models.Contact{}).Where("user_id = ?", userID).Pluck("contact_id", &ids)
+	return idSet(ids)
+}
@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"chat-backend/models"
+)
+
+func TestFriendRequestViewHidesPrivateFields(t *testing.T) {
+	user := func(id uint, name string) models.User {
+		return models.User{ID: id, Username: name, Email: name + "@example.com", Phone: "+1555" + name, Status: "online"}
+	}
+	request := models.FriendRequest{
+		ID:          1,
+		SenderID:    1,
+		Sender:      user(1, "alice"),
+		RecipientID: 2,
+		Recipient:   user(2, "bob"),
+		Status:      models.FriendRequestPending,
+	}
+
+	data, err := json.Marshal(newFriendRequestView(request))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, private := range []string{"@example.com", "+1555", "online", "last_seen", "visibility"} {
+		if strings.Contains(string(data), private) {
+			t.Errorf("friend request JSON contains %q: %s", private, data)
+		}
+	}
+
+	var decoded struct {
+		Sender    struct{ Username string } `json:"sender"`
+		Recipient struct{ Username string } `json:"recipient"`
+		Status    string                    `json:"status"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Sender.Username != "alice" || decoded.Recipient.Username != "bob" || decoded.Status != "pending" {
+		t.Errorf("friend request JSON = %s, want both usernames and the status", data)
+	}
+}
@@ -27,6 +27,17 @@ func CreateConversation(c *gin.Context) {
 		return
 	}
 
+	// Blocks apply in both directions for direct messages
+	if input.Type == "direct" && isBlockedEitherWay(user.ID, input.ParticipantID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot message this user"})
+		return
+	}
+
+	if input.Type == "direct" && directMessagesContactsOnly() && !areContacts(user.ID, input.ParticipantID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only message your contacts"})
+		return
+	}
+
 	// For direct messages, check if conversation already exists
 	if input.Type == "direct" {
 		var existingConv models.Conversation
@@ -66,7 +77,12 @@ func CreateConversation(c *gin.Context) {
 			participants = append(participants, otherUser)
 		}
 	} else if input.Type == "group" && len(input.ParticipantIDs) > 0 {
-		database.DB.Where("id IN ?", input.ParticipantIDs).Find(&participants)
+		// Users who blocked the creator cannot be pulled into their groups
+		query := database.DB.Where("id IN ?", input.ParticipantIDs)
+		if blockers := blockerIDsOf(user.ID); len(blockers) > 0 {
+			query = query.Where("id NOT IN ?", mapKeys(blockers))
+		}
+		query.Find(&participants)
 	}
 
 	database.DB.Model(&conversation).Association("Participants").Append(participants)
@@ -87,9 +103,12 @@ func GetConversations(c *gin.Context) {
 		Where("conversation_participants.user_id = ?", user.ID).
 		Preload("Participants").
 		Preload("Messages", func(db *gorm.DB) *gorm.DB {
-			return db.Order("created_at DESC").Limit(1)
+			return db.Where("sender_id NOT IN (?)", blockedSenderSubquery(user.ID)).
+				Scopes(unexpiredMessages).
+				Order("created_at DESC").Limit(1)
 		}).
 		Preload("Messages.Sender").
+		Preload("Messages.LinkPreview").
 		Order("conversations.updated_at DESC").
 		Find(&conversations).Error
 
@@ -98,6 +117,17 @@ func GetConversations(c *gin.Context) {
 		return
 	}
 
+	for i := range conversations {
+		maskPresence(conversations[i].Participants, user.ID)
+		maskSenderPresence(conversations[i].Messages, user.ID)
+		attachEntities(conversations[i].Messages)
+		attachPolls(conversations[i].Messages, user.ID)
+		attachVoicePlays(conversations[i].Messages, user.ID)
+		attachStars(conversations[i].Messages, user.ID)
+	}
+	applyReadStates(conversations, user.ID)
+	attachDrafts(conversations, user.ID)
+
 	c.JSON(http.StatusOK, gin.H{"conversations": conversations})
 }
 
@@ -121,13 +151,23 @@ func GetMessages(c *gin.Context) {
 	var messages []models.Message
 	if err := database.DB.
 		Where("conversation_id = ?", conversationID).
+		Where("sender_id NOT IN (?)", blockedSenderSubquery(user.ID)).
+		Scopes(unexpiredMessages).
 		Preload("Sender").
-		Preload("ReplyTo").
+		Preload("ReplyTo", unexpiredMessages).
+		Preload("Pin.PinnedBy").
+		Preload("LinkPreview").
 		Order("created_at ASC").
 		Find(&messages).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
 		return
 	}
 
+	maskSenderPresence(messages, user.ID)
+	attachEntities(messages)
+	attachPolls(messages, user.ID)
+	attachVoicePlays(messages, user.ID)
+	attachStars(messages, user.ID)
+
 	c.JSON(http.StatusOK, gin.H{"messages": messages})
 }
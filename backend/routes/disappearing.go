@@ -0,0 +1,240 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	uploadsURLPrefix = "/uploads/"
+	expiryBatchSize  = 500
+)
+
+type SetDisappearingTimerInput struct {
+	MessageTTL *int `json:"message_ttl" binding:"required"` // Seconds; 0 turns the timer off
+}
+
+// SetDisappearingTimer changes how long new messages in a conversation live.
+// Messages already sent keep their expiry. In groups only the creator may
+// change the timer; the change is announced with a system message.
+func SetDisappearingTimer(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var input SetDisappearingTimerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	label, ok := models.DisappearingTimers[*input.MessageTTL]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message_ttl must be 0, 3600, 86400 or 604800"})
+		return
+	}
+
+	var conversation models.Conversation
+	if err := database.DB.Preload("Participants").First(&conversation, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+	if err := checkCanPost(user.ID, conversation); err != nil {
+		respondActionError(c, err, "Failed to update disappearing messages")
+		return
+	}
+	// Groups have no roles yet; the creator acts as the admin
+	if conversation.Type == models.GroupChat && conversation.CreatedBy != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the group admin can change disappearing messages"})
+		return
+	}
+
+	if conversation.MessageTTL == *input.MessageTTL {
+		c.JSON(http.StatusOK, gin.H{"message_ttl": conversation.MessageTTL})
+		return
+	}
+
+	content := fmt.Sprintf("%s set disappearing messages to %s", displayNameOf(user), label)
+	if *input.MessageTTL == 0 {
+		content = fmt.Sprintf("%s turned off disappearing messages", displayNameOf(user))
+	}
+	message := models.Message{
+		ConversationID: conversation.ID,
+		SenderID:       user.ID,
+		Content:        content,
+		Type:           models.SystemMessage,
+		Status:         models.MessageSent,
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Conversation{}).Where("id = ?", conversation.ID).Update("message_ttl", *input.MessageTTL).Error; err != nil {
+			return err
+		}
+		_, err := saveMessage(hub, tx, &message, conversation)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update disappearing messages"})
+		return
+	}
+	conversation.MessageTTL = *input.MessageTTL
+
+	message.Sender = user
+	deliverMessage(hub, conversation, message, nil)
+
+	hub.SendToUsers(participantIDs(conversation), map[string]interface{}{
+		"type":            "disappearing_timer_updated",
+		"conversation_id": conversation.ID,
+		"message_ttl":     conversation.MessageTTL,
+		"updated_by":      user.ID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message_ttl": conversation.MessageTTL, "message": message})
+}
+
+// unexpiredMessages hides messages whose timer has run out but which the
+// expiry job has not deleted yet.
+func unexpiredMessages(db *gorm.DB) *gorm.DB {
+	return db.Where("messages.expires_at IS NULL OR messages.expires_at > ?", time.Now())
+}
+
+// RunMessageExpiry hard-deletes expired messages and tells participants to
+// purge them. Rows are claimed with FOR UPDATE SKIP LOCKED, so several
+// replicas can run the job side by side.
+func RunMessageExpiry(hub *Hub) {
+	ticker := time.NewTicker(envDuration("MESSAGE_EXPIRY_INTERVAL", 30*time.Second))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// Keep going while full batches come back, so a backlog drains quickly
+		for expireMessages(hub) == expiryBatchSize {
+		}
+	}
+}
+
+func expireMessages(hub *Hub) int {
+	var expired []models.Message
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Select("id", "conversation_id", "media_url").
+			Where("expires_at <= ?", time.Now()).
+			Limit(expiryBatchSize).
+			Find(&expired).Error; err != nil {
+			return err
+		}
+		if len(expired) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(expired))
+		for i := range expired {
+			ids[i] = expired[i].ID
+		}
+		return deleteMessages(tx, ids)
+	})
+	if err != nil {
+		log.Printf("Error expiring messages: %v", err)
+		return 0
+	}
+	if len(expired) == 0 {
+		return 0
+	}
+
+	byConversation := map[uint][]uint{}
+	var mediaURLs []string
+	for _, message := range expired {
+		byConversation[message.ConversationID] = append(byConversation[message.ConversationID], message.ID)
+		if message.MediaURL != "" {
+			mediaURLs = append(mediaURLs, message.MediaURL)
+		}
+	}
+
+	for conversationID, messageIDs := range byConversation {
+		var userIDs []uint
+		database.DB.Table("conversation_participants").Where("conversation_id = ?", conversationID).Pluck("user_id", &userIDs)
+		hub.SendToUsers(userIDs, map[string]interface{}{
+			"type":            "message_expired",
+			"conversation_id": conversationID,
+			"message_ids":     messageIDs,
+		})
+	}
+
+	removeMessageMedia(mediaURLs)
+
+	return len(expired)
+}
+
+// deleteMessages hard-deletes messages together with the rows hanging off
+// them. The SQL migrations cascade these, but a schema built by AutoMigrate
+// has foreign keys without ON DELETE actions, so they are removed here.
+func deleteMessages(tx *gorm.DB, ids []uint) error {
+	if err := tx.Unscoped().Model(&models.Message{}).Where("reply_to_id IN ?", ids).Update("reply_to_id", nil).Error; err != nil {
+		return err
+	}
+
+	var pollIDs []uint
+	if err := tx.Model(&models.Poll{}).Where("message_id IN ?", ids).Pluck("id", &pollIDs).Error; err != nil {
+		return err
+	}
+	if len(pollIDs) > 0 {
+		if err := tx.Where("poll_id IN ?", pollIDs).Delete(&models.PollVote{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("poll_id IN ?", pollIDs).Delete(&models.PollOption{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", pollIDs).Delete(&models.Poll{}).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, dependent := range []interface{}{&models.PinnedMessage{}, &models.MessageMention{}, &models.StarredMessage{}, &models.VoicePlay{}} {
+		if err := tx.Where("message_id IN ?", ids).Delete(dependent).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Message{}).Error
+}
+
+// removeMessageMedia deletes uploaded files that only deleted messages
+// pointed at. Media hosted elsewhere, avatars and files still referenced by
+// another message are left alone.
+func removeMessageMedia(mediaURLs []string) {
+	for _, mediaURL := range mediaURLs {
+		if !strings.HasPrefix(mediaURL, uploadsURLPrefix) || strings.HasPrefix(mediaURL, avatarURLPrefix) {
+			continue
+		}
+
+		var count int64
+		database.DB.Unscoped().Model(&models.Message{}).Where("media_url = ?", mediaURL).Count(&count)
+		if count > 0 {
+			continue
+		}
+		database.DB.Model(&models.ScheduledMessage{}).
+			Where("media_url = ? AND status = ?", mediaURL, models.ScheduledPending).
+			Count(&count)
+		if count > 0 {
+			continue
+		}
+
+		// Cleaning against the root keeps ".." from leaving the upload directory
+		name := filepath.Clean("/" + strings.TrimPrefix(mediaURL, uploadsURLPrefix))
+		if err := os.Remove(filepath.Join(UploadDir(), name)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove expired media %s: %v", mediaURL, err)
+		}
+	}
+}
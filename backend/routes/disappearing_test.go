@@ -0,0 +1,66 @@
+package routes
+
+import (
+	"testing"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+)
+
+func TestExpireMessagesRemovesDependentRows(t *testing.T) {
+	useTestDB(t)
+
+	alice := createTestUser(t, "expiry_alice")
+	bob := createTestUser(t, "expiry_bob")
+	group := createTestConversation(t, models.GroupChat, alice, bob)
+
+	pinned := createTestMessage(t, group, alice, "pinned")
+	database.DB.Create(&models.PinnedMessage{MessageID: pinned.ID, ConversationID: group.ID, PinnedByID: bob.ID})
+
+	pollMessage := createTestMessage(t, group, alice, "lunch?")
+	poll := models.Poll{
+		MessageID:      pollMessage.ID,
+		ConversationID: group.ID,
+		Question:       "lunch?",
+		Options:        []models.PollOption{{Position: 0, Text: "yes"}, {Position: 1, Text: "no"}},
+	}
+	database.DB.Create(&poll)
+	database.DB.Create(&models.PollVote{OptionID: poll.Options[0].ID, UserID: bob.ID, PollID: poll.ID})
+
+	repliedTo := createTestMessage(t, group, alice, "question")
+	reply := createTestMessage(t, group, bob, "answer")
+	database.DB.Model(&reply).Update("reply_to_id", repliedTo.ID)
+
+	expired := []uint{pinned.ID, pollMessage.ID, repliedTo.ID}
+	database.DB.Model(&models.Message{}).Where("id IN ?", expired).Update("expires_at", time.Now().Add(-time.Minute))
+
+	hub := NewHub()
+	if n := expireMessages(hub); n != len(expired) {
+		t.Fatalf("expireMessages = %d, want %d", n, len(expired))
+	}
+
+	var remaining int64
+	database.DB.Unscoped().Model(&models.Message{}).Where("id IN ?", expired).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("%d expired messages were left", remaining)
+	}
+
+	var pins, polls, options, votes int64
+	database.DB.Model(&models.PinnedMessage{}).Where("message_id = ?", pinned.ID).Count(&pins)
+	database.DB.Model(&models.Poll{}).Where("id = ?", poll.ID).Count(&polls)
+	database.DB.Model(&models.PollOption{}).Where("poll_id = ?", poll.ID).Count(&options)
+	database.DB.Model(&models.PollVote{}).Where("poll_id = ?", poll.ID).Count(&votes)
+	if pins+polls+options+votes != 0 {
+		t.Errorf("left %d pins, %d polls, %d options and %d votes", pins, polls, options, votes)
+	}
+
+	database.DB.First(&reply, reply.ID)
+	if reply.ReplyToID != nil {
+		t.Errorf("reply still points at expired message %d", *reply.ReplyToID)
+	}
+
+	if events := drainEvents(t, hub); events[bob.ID]["type"] != "message_expired" {
+		t.Errorf("participant got %v, want message_expired", events[bob.ID])
+	}
+}
@@ -0,0 +1,147 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// maxDraftBytes matches the longest markdown message.
+const maxDraftBytes = maxMarkupBytes
+
+// DraftInput replaces the draft; empty content without a reply deletes it.
+type DraftInput struct {
+	Content   string `json:"content"`
+	ReplyToID *uint  `json:"reply_to_id"`
+}
+
+// SaveDraft stores the current user's draft for a conversation and syncs it
+// to their connected clients with a draft_updated event.
+func SaveDraft(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		return
+	}
+
+	var input DraftInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	draft, err := saveDraft(user.ID, uint(conversationID), input)
+	if err != nil {
+		respondActionError(c, err, "Failed to save draft")
+		return
+	}
+
+	// A REST caller has no connection to skip, so all of them are told
+	hub.SendToUsers([]uint{user.ID}, draftUpdatedEvent(uint(conversationID), draft))
+
+	c.JSON(http.StatusOK, gin.H{"draft": draft})
+}
+
+// saveDraft upserts or, when the input is empty, deletes a draft. It returns
+// nil for a deleted draft.
+func saveDraft(userID, conversationID uint, input DraftInput) (*models.Draft, error) {
+	var count int64
+	database.DB.Table("conversation_participants").
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Count(&count)
+	if count == 0 {
+		return nil, &actionError{http.StatusForbidden, "Access denied"}
+	}
+
+	if len(input.Content) > maxDraftBytes {
+		return nil, &actionError{http.StatusBadRequest, "Draft is too long"}
+	}
+
+	if strings.TrimSpace(input.Content) == "" && input.ReplyToID == nil {
+		if _, err := deleteDraft(userID, conversationID); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	if input.ReplyToID != nil {
+		database.DB.Model(&models.Message{}).
+			Scopes(visibleMessages(userID)).
+			Where("messages.id = ? AND messages.conversation_id = ?", *input.ReplyToID, conversationID).
+			Count(&count)
+		if count == 0 {
+			return nil, &actionError{http.StatusNotFound, "Reply target not found"}
+		}
+	}
+
+	draft := models.Draft{
+		UserID:         userID,
+		ConversationID: conversationID,
+		Content:        input.Content,
+		ReplyToID:      input.ReplyToID,
+		UpdatedAt:      time.Now(),
+	}
+	if err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "conversation_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"content", "reply_to_id", "updated_at"}),
+	}).Create(&draft).Error; err != nil {
+		return nil, err
+	}
+	return &draft, nil
+}
+
+// deleteDraft removes a draft, reporting whether there was one.
+func deleteDraft(userID, conversationID uint) (bool, error) {
+	result := database.DB.
+		Where("user_id = ? AND conversation_id = ?", userID, conversationID).
+		Delete(&models.Draft{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// clearDraftAfterSend drops the sender's draft once they sent a message to
+// the conversation and tells their clients.
+func clearDraftAfterSend(hub *Hub, message models.Message) {
+	if deleted, err := deleteDraft(message.SenderID, message.ConversationID); err == nil && deleted {
+		hub.SendToUsers([]uint{message.SenderID}, draftUpdatedEvent(message.ConversationID, nil))
+	}
+}
+
+func draftUpdatedEvent(conversationID uint, draft *models.Draft) map[string]interface{} {
+	return map[string]interface{}{
+		"type":            "draft_updated",
+		"conversation_id": conversationID,
+		"draft":           draft, // null once the draft is cleared
+	}
+}
+
+// attachDrafts fills in userID's drafts on their conversations.
+func attachDrafts(conversations []models.Conversation, userID uint) {
+	if len(conversations) == 0 {
+		return
+	}
+	ids := make([]uint, len(conversations))
+	for i := range conversations {
+		ids[i] = conversations[i].ID
+	}
+
+	var drafts []models.Draft
+	database.DB.Where("user_id = ? AND conversation_id IN ?", userID, ids).Find(&drafts)
+
+	byConversation := make(map[uint]*models.Draft, len(drafts))
+	for i := range drafts {
+		byConversation[drafts[i].ConversationID] = &drafts[i]
+	}
+	for i := range conversations {
+		conversations[i].Draft = byConversation[conversations[i].ID]
+	}
+}
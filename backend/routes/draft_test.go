@@ -0,0 +1,131 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"chat-backend/database"
+	"chat-backend/models"
+)
+
+// draftOf loads userID's draft for conversation, or nil.
+func draftOf(userID uint, conversation models.Conversation) *models.Draft {
+	var draft models.Draft
+	if err := database.DB.Where("user_id = ? AND conversation_id = ?", userID, conversation.ID).First(&draft).Error; err != nil {
+		return nil
+	}
+	return &draft
+}
+
+func TestSaveDraftUpsertsAndDeletes(t *testing.T) {
+	useTestDB(t)
+
+	alice := createTestUser(t, "draft_alice")
+	bob := createTestUser(t, "draft_bob")
+	direct := createTestConversation(t, models.DirectMessage, alice, bob)
+	other := createTestConversation(t, models.DirectMessage, bob, createTestUser(t, "draft_carol"))
+	question := createTestMessage(t, direct, bob, "question")
+	elsewhere := createTestMessage(t, other, bob, "elsewhere")
+
+	if _, err := saveDraft(alice.ID, direct.ID, DraftInput{Content: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := saveDraft(alice.ID, direct.ID, DraftInput{Content: "second", ReplyToID: &question.ID}); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	database.DB.Model(&models.Draft{}).Where("user_id = ?", alice.ID).Count(&count)
+	draft := draftOf(alice.ID, direct)
+	if count != 1 || draft == nil || draft.Content != "second" || draft.ReplyToID == nil || *draft.ReplyToID != question.ID {
+		t.Fatalf("after two saves alice has %d drafts, latest %+v; want one replying with the second content", count, draft)
+	}
+
+	// A reply alone is worth keeping
+	if draft, err := saveDraft(alice.ID, direct.ID, DraftInput{ReplyToID: &question.ID}); err != nil || draft == nil {
+		t.Errorf("saving a bare reply = %+v, %v; want a draft", draft, err)
+	}
+	if draft, err := saveDraft(alice.ID, direct.ID, DraftInput{Content: "  "}); err != nil || draft != nil || draftOf(alice.ID, direct) != nil {
+		t.Errorf("saving blank content = %+v, %v; want the draft deleted", draft, err)
+	}
+
+	tests := []struct {
+		name         string
+		conversation models.Conversation
+		input        DraftInput
+		status       int
+	}{
+		{"not a participant", other, DraftInput{Content: "hi"}, http.StatusForbidden},
+		{"too long", direct, DraftInput{Content: strings.Repeat("a", maxDraftBytes+1)}, http.StatusBadRequest},
+		{"reply to another conversation", direct, DraftInput{Content: "hi", ReplyToID: &elsewhere.ID}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		var actionErr *actionError
+		if _, err := saveDraft(alice.ID, tt.conversation.ID, tt.input); !errors.As(err, &actionErr) || actionErr.status != tt.status {
+			t.Errorf("%s: saveDraft = %v, want status %d", tt.name, err, tt.status)
+		}
+	}
+}
+
+func TestDraftIsClearedAfterSending(t *testing.T) {
+	useTestDB(t)
+
+	alice := createTestUser(t, "cleared_alice")
+	bob := createTestUser(t, "cleared_bob")
+	direct := createTestConversation(t, models.DirectMessage, alice, bob)
+	hub := NewHub()
+
+	if _, err := saveDraft(alice.ID, direct.ID, DraftInput{Content: "almost"}); err != nil {
+		t.Fatal(err)
+	}
+	clearDraftAfterSend(hub, createTestMessage(t, direct, bob, "bob's message"))
+	if draftOf(alice.ID, direct) == nil {
+		t.Fatal("another participant's message cleared alice's draft")
+	}
+
+	clearDraftAfterSend(hub, createTestMessage(t, direct, alice, "almost"))
+	if draftOf(alice.ID, direct) != nil {
+		t.Error("draft survived sending")
+	}
+	event := drainEvents(t, hub)[alice.ID]
+	if event["type"] != "draft_updated" || event["draft"] != nil {
+		t.Errorf("sender got %v, want draft_updated with a null draft", event)
+	}
+
+	// Nothing to clear, nothing to announce
+	clearDraftAfterSend(hub, createTestMessage(t, direct, alice, "again"))
+	if events := drainEvents(t, hub); len(events) != 0 {
+		t.Errorf("clearing a missing draft sent %v", events)
+	}
+}
+
+func TestForwardingClearsTheTargetDraft(t *testing.T) {
+	useTestDB(t)
+
+	alice := createTestUser(t, "fwd_draft_alice")
+	bob := createTestUser(t, "fwd_draft_bob")
+	source := createTestConversation(t, models.DirectMessage, alice, bob)
+	target := createTestConversation(t, models.GroupChat, alice, bob)
+	message := createTestMessage(t, source, bob, "pass it on")
+
+	for _, conversation := range []models.Conversation{source, target} {
+		if _, err := saveDraft(alice.ID, conversation.ID, DraftInput{Content: "unsent"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recorder := callHandler(forwardHandler(NewHub()), alice, http.MethodPost,
+		fmt.Sprintf(`{"message_ids": [%d], "conversation_ids": [%d]}`, message.ID, target.ID))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("forward = %d %s, want %d", recorder.Code, recorder.Body, http.StatusCreated)
+	}
+
+	if draftOf(alice.ID, target) != nil {
+		t.Error("draft in the target conversation survived the forward")
+	}
+	if draftOf(alice.ID, source) == nil {
+		t.Error("forwarding cleared the draft in the source conversation")
+	}
+}
@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ForwardMessagesInput struct {
+	MessageIDs      []uint `json:"message_ids" binding:"required,min=1,max=20"`
+	ConversationIDs []uint `json:"conversation_ids" binding:"required,min=1,max=10"`
+}
+
+// ForwardMessages copies messages into other conversations, keeping their
+// media and attributing them to the original sender and conversation. The
+// current user must take part in every source and target conversation.
+func ForwardMessages(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var input ForwardMessagesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	memberOf := idSet(conversationIDsOf(user.ID))
+
+	// Messages from users the forwarder blocked are hidden from them, so
+	// they cannot be forwarded either
+	var sources []models.Message
+	if err := database.DB.
+		Where("id IN ?", input.MessageIDs).
+		Where("sender_id NOT IN (?)", blockedSenderSubquery(user.ID)).
+		Where("type NOT IN ?", []models.MessageType{models.SystemMessage, models.PollMessage}).
+		Scopes(unexpiredMessages).
+		Preload("Sender").
+		Preload("LinkPreview").
+		Order("created_at ASC, id ASC").
+		Find(&sources).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
+		return
+	}
+	if len(sources) != len(idSet(input.MessageIDs)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	for _, source := range sources {
+		if !memberOf[source.ConversationID] {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+			return
+		}
+	}
+
+	var targets []models.Conversation
+	if err := database.DB.Where("id IN ?", input.ConversationIDs).Preload("Participants").Find(&targets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversations"})
+		return
+	}
+	if len(targets) != len(idSet(input.ConversationIDs)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+	for _, target := range targets {
+		if !memberOf[target.ID] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			return
+		}
+		if target.Type == models.DirectMessage {
+			for _, participant := range target.Participants {
+				if participant.ID != user.ID && isBlockedEitherWay(user.ID, participant.ID) {
+					c.JSON(http.StatusForbidden, gin.H{"error": "You cannot message this user"})
+					return
+				}
+			}
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].ID < targets[j].ID })
+
+	var forwarded []models.Message
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, target := range targets {
+			for _, source := range sources {
+				message := models.Message{
+					ConversationID: target.ID,
+					SenderID:       user.ID,
+					Content:        source.Content,
+					Type:           source.Type,
+					Status:         models.MessageSent,
+					MediaURL:       source.MediaURL,
+					Attachment:     source.Attachment,
+					Format:         source.Format,
+					Markup:         source.Markup,
+					Formatting:     source.Formatting,
+					ForwardedFrom:  forwardedFrom(source),
+					LinkPreviewID:  source.LinkPreviewID,
+					ExpiresAt:      target.MessageExpiry(time.Now()),
+				}
+				if err := tx.Create(&message).Error; err != nil {
+					return err
+				}
+				message.LinkPreview = source.LinkPreview
+				forwarded = append(forwarded, message)
+			}
+
+			if err := tx.Model(&models.Conversation{}).Where("id = ?", target.ID).Update("updated_at", time.Now()).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to forward messages"})
+		return
+	}
+
+	for i := range forwarded {
+		forwarded[i].Sender = user
+	}
+
+	for _, target := range targets {
+		var last *models.Message
+		for i, message := range forwarded {
+			if message.ConversationID == target.ID {
+				deliverMessage(hub, target, message, nil)
+				last = &forwarded[i]
+			}
+		}
+		if last != nil {
+			clearDraftAfterSend(hub, *last)
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"messages": forwarded})
+}
+
+// forwardedFrom attributes a copy of source, keeping the first attribution
+// when source was itself forwarded.
+func forwardedFrom(source models.Message) models.ForwardedFrom {
+	if source.ForwardedFrom.MessageID != nil || source.ForwardedFrom.SenderID != nil {
+		return source.ForwardedFrom
+	}
+
+	return models.ForwardedFrom{
+		MessageID:      &source.ID,
+		SenderID:       &source.SenderID,
+		SenderName:     displayNameOf(source.Sender),
+		ConversationID: &source.ConversationID,
+	}
+}
@@ -0,0 +1,88 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestForwardedFromKeepsTheFirstAttribution(t *testing.T) {
+	source := models.Message{
+		ID:             10,
+		ConversationID: 3,
+		SenderID:       4,
+		Sender:         models.User{ID: 4, Username: "alice", DisplayName: "Alice"},
+	}
+
+	first := forwardedFrom(source)
+	if *first.MessageID != 10 || *first.SenderID != 4 || *first.ConversationID != 3 || first.SenderName != "Alice" {
+		t.Fatalf("forwardedFrom = %+v, want message 10 by Alice in conversation 3", first)
+	}
+
+	copied := models.Message{ID: 11, ConversationID: 5, SenderID: 6, ForwardedFrom: first}
+	if again := forwardedFrom(copied); *again.MessageID != 10 || again.SenderName != "Alice" {
+		t.Errorf("forwarding a forward = %+v, want the original attribution", again)
+	}
+}
+
+func forwardHandler(hub *Hub) gin.HandlerFunc {
+	return func(c *gin.Context) { ForwardMessages(hub, c) }
+}
+
+func TestForwardMessagesRequiresMembership(t *testing.T) {
+	useTestDB(t)
+
+	alice := createTestUser(t, "forward_alice")
+	bob := createTestUser(t, "forward_bob")
+	carol := createTestUser(t, "forward_carol")
+
+	source := createTestConversation(t, models.GroupChat, alice, bob)
+	target := createTestConversation(t, models.GroupChat, alice, carol)
+	foreign := createTestConversation(t, models.GroupChat, bob, carol)
+	message := createTestMessage(t, source, bob, "worth sharing")
+	foreignMessage := createTestMessage(t, foreign, bob, "not for alice")
+
+	hub := NewHub()
+	forward := func(messageID, conversationID uint) *httptest.ResponseRecorder {
+		return callHandler(forwardHandler(hub), alice, http.MethodPost,
+			fmt.Sprintf(`{"message_ids": [%d], "conversation_ids": [%d]}`, messageID, conversationID))
+	}
+
+	if recorder := forward(foreignMessage.ID, target.ID); recorder.Code != http.StatusNotFound {
+		t.Errorf("forwarding from a conversation alice is not in = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+	if recorder := forward(message.ID, foreign.ID); recorder.Code != http.StatusForbidden {
+		t.Errorf("forwarding into a conversation alice is not in = %d, want %d", recorder.Code, http.StatusForbidden)
+	}
+
+	recorder := forward(message.ID, target.ID)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("forward = %d %s, want %d", recorder.Code, recorder.Body, http.StatusCreated)
+	}
+	var body struct {
+		Messages []models.Message `json:"messages"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Messages) != 1 {
+		t.Fatalf("forwarded %d messages, want 1", len(body.Messages))
+	}
+	copied := body.Messages[0]
+	if copied.ConversationID != target.ID || copied.SenderID != alice.ID || copied.Content != message.Content {
+		t.Errorf("forwarded copy = %+v, want alice's copy in the target", copied)
+	}
+	if copied.ForwardedFrom.MessageID == nil || *copied.ForwardedFrom.MessageID != message.ID {
+		t.Errorf("forwarded copy attribution = %+v, want message %d", copied.ForwardedFrom, message.ID)
+	}
+
+	if events := drainEvents(t, hub); events[carol.ID]["type"] != "new_message" {
+		t.Errorf("target participant got %v, want new_message", events[carol.ID])
+	}
+}
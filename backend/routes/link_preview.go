@@ -0,0 +1,449 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"golang.org/x/net/html"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	linkPreviewMaxBytes    = 512 << 10 // 512 KB is plenty to reach the end of <head>
+	linkPreviewMaxURL      = 2048
+	linkPreviewFailureTTL  = time.Hour
+	linkPreviewConcurrency = 8
+	linkPreviewQueueSize   = 256
+)
+
+// linkPattern finds http(s) links in message content; trailing punctuation
+// is trimmed afterwards.
+var linkPattern = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `]+`)
+
+var errBlockedAddress = errors.New("destination address is not allowed")
+
+// blockedPrefixes are address ranges a preview fetch must never reach:
+// loopback, private, link-local, CGNAT, documentation, benchmarking,
+// multicast and reserved space.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/32"), // Teredo embeds an IPv4 address
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"), // So does 6to4
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// isPublicAddrPort allows only public addresses on the standard web ports.
+func isPublicAddrPort(addrPort netip.AddrPort) bool {
+	if addrPort.Port() != 80 && addrPort.Port() != 443 {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// linkFetcher fetches pages for link previews. Every connection is checked
+// against allow after DNS resolution, so neither redirects nor DNS rebinding
+// can reach an internal address.
+type linkFetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+func newLinkFetcher(allow func(netip.AddrPort) bool, timeout time.Duration, maxBytes int64) *linkFetcher {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !allow(addrPort) {
+				return errBlockedAddress
+			}
+			return nil
+		},
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil, // A proxy would make the dialer check meaningless
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	return &linkFetcher{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 5 {
+					return errors.New("too many redirects")
+				}
+				if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+					return errors.New("unsupported redirect scheme")
+				}
+				return nil
+			},
+		},
+		maxBytes: maxBytes,
+	}
+}
+
+var (
+	previewFetcher     *linkFetcher
+	previewFetcherOnce sync.Once
+)
+
+// unfurlJob is a message waiting for its link preview.
+type unfurlJob struct {
+	hub          *Hub
+	conversation models.Conversation
+	message      models.Message
+	link         string
+}
+
+var (
+	unfurlQueue       = make(chan unfurlJob, linkPreviewQueueSize)
+	unfurlWorkersOnce sync.Once
+)
+
+// getPreviewFetcher builds the fetcher from LINK_PREVIEW_TIMEOUT on first use.
+func getPreviewFetcher() *linkFetcher {
+	previewFetcherOnce.Do(func() {
+		previewFetcher = newLinkFetcher(isPublicAddrPort, envDuration("LINK_PREVIEW_TIMEOUT", 5*time.Second), linkPreviewMaxBytes)
+	})
+	return previewFetcher
+}
+
+// get fetches rawURL and returns at most maxBytes of the body together with
+// the final URL after redirects and the media type.
+func (f *linkFetcher) get(ctx context.Context, rawURL, accept string) ([]byte, *url.URL, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; ChatLinkPreview/1.0)")
+	req.Header.Set("Accept", accept)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil, "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes))
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	return body, resp.Request.URL, mediaType, nil
+}
+
+// fetchPreview reads OpenGraph tags from an HTML page, falling back to the
+// page title and to the page's oEmbed endpoint for anything missing.
+func (f *linkFetcher) fetchPreview(ctx context.Context, rawURL string) (models.LinkPreview, error) {
+	body, finalURL, mediaType, err := f.get(ctx, rawURL, "text/html,application/xhtml+xml")
+	if err != nil {
+		return models.LinkPreview{}, err
+	}
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return models.LinkPreview{}, fmt.Errorf("unsupported content type %q", mediaType)
+	}
+
+	preview, oembedURL := parseHTMLPreview(body, finalURL)
+	if oembedURL != "" && (preview.Title == "" || preview.ImageURL == "") {
+		if data, _, _, err := f.get(ctx, oembedURL, "application/json"); err == nil {
+			applyOEmbed(&preview, data, finalURL)
+		}
+	}
+
+	if preview.Title == "" && preview.Description == "" {
+		return models.LinkPreview{}, errors.New("page has no preview metadata")
+	}
+
+	preview.Title = truncateRunes(preview.Title, 300)
+	preview.Description = truncateRunes(preview.Description, 1000)
+	preview.SiteName = truncateRunes(preview.SiteName, 200)
+	return preview, nil
+}
+
+// parseHTMLPreview collects metadata from the <head> of a page. It returns
+// the oEmbed discovery URL, if the page advertises one.
+func parseHTMLPreview(body []byte, base *url.URL) (models.LinkPreview, string) {
+	var preview models.LinkPreview
+	var title, oembedURL string
+	meta := map[string]string{}
+
+	tokenizer := html.NewTokenizer(strings.NewReader(strings.ToValidUTF8(string(body), "")))
+tokens:
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break tokens
+		}
+		token := tokenizer.Token()
+
+		if tokenType == html.EndTagToken && token.Data == "head" {
+			break tokens
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+
+		attrs := map[string]string{}
+		for _, attr := range token.Attr {
+			attrs[strings.ToLower(attr.Key)] = attr.Val
+		}
+
+		switch token.Data {
+		case "body":
+			break tokens
+		case "title":
+			if tokenizer.Next() == html.TextToken && title == "" {
+				title = strings.TrimSpace(tokenizer.Token().Data)
+			}
+		case "meta":
+			key := strings.ToLower(attrs["property"])
+			if key == "" {
+				key = strings.ToLower(attrs["name"])
+			}
+			if _, seen := meta[key]; key != "" && !seen {
+				meta[key] = strings.TrimSpace(attrs["content"])
+			}
+		case "link":
+			if strings.EqualFold(attrs["rel"], "alternate") && strings.EqualFold(attrs["type"], "application/json+oembed") && oembedURL == "" {
+				oembedURL = resolveWebURL(base, attrs["href"])
+			}
+		}
+	}
+
+	preview.Title = firstNonEmpty(meta["og:title"], meta["twitter:title"], title)
+	preview.Description = firstNonEmpty(meta["og:description"], meta["twitter:description"], meta["description"])
+	preview.ImageURL = resolveWebURL(base, firstNonEmpty(meta["og:image"], meta["og:image:url"], meta["twitter:image"]))
+	preview.SiteName = meta["og:site_name"]
+
+	return preview, oembedURL
+}
+
+// applyOEmbed fills fields the page itself did not provide.
+func applyOEmbed(preview *models.LinkPreview, data []byte, base *url.URL) {
+	var oembed struct {
+		Title        string `json:"title"`
+		AuthorName   string `json:"author_name"`
+		ProviderName string `json:"provider_name"`
+		ThumbnailURL string `json:"thumbnail_url"`
+	}
+	if err := json.Unmarshal(data, &oembed); err != nil {
+		return
+	}
+
+	preview.Title = firstNonEmpty(preview.Title, oembed.Title)
+	preview.Description = firstNonEmpty(preview.Description, oembed.AuthorName)
+	preview.SiteName = firstNonEmpty(preview.SiteName, oembed.ProviderName)
+	if preview.ImageURL == "" {
+		preview.ImageURL = resolveWebURL(base, oembed.ThumbnailURL)
+	}
+}
+
+// resolveWebURL resolves ref against base, keeping only http(s) results.
+func resolveWebURL(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	resolved, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil || (resolved.Scheme != "http" && resolved.Scheme != "https") || len(resolved.String()) > linkPreviewMaxURL {
+		return ""
+	}
+	return resolved.String()
+}
+
+// firstPreviewableURL returns the first http(s) link in content, or "" when
+// there is none. Links carrying credentials are never fetched.
+func firstPreviewableURL(content string) string {
+	for _, match := range linkPattern.FindAllString(content, -1) {
+		match = strings.TrimRight(match, ".,;:!?'\"]}")
+		// Keep a closing parenthesis only when it balances one in the link
+		for strings.HasSuffix(match, ")") && strings.Count(match, "(") < strings.Count(match, ")") {
+			match = strings.TrimSuffix(match, ")")
+		}
+
+		parsed, err := url.Parse(match)
+		if err != nil || parsed.Host == "" || parsed.User != nil || len(match) > linkPreviewMaxURL {
+			continue
+		}
+		return match
+	}
+	return ""
+}
+
+// linkPreviewFor returns the cached preview for rawURL, fetching it when the
+// cache is missing or stale. It returns nil when the page has no preview.
+func linkPreviewFor(rawURL string) (*models.LinkPreview, error) {
+	var cached models.LinkPreview
+	if err := database.DB.Where("url = ?", rawURL).First(&cached).Error; err == nil {
+		ttl := envDuration("LINK_PREVIEW_CACHE_TTL", 24*time.Hour)
+		if cached.Failed {
+			ttl = linkPreviewFailureTTL
+		}
+		if time.Since(cached.FetchedAt) < ttl {
+			if cached.Failed {
+				return nil, nil
+			}
+			return &cached, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*envDuration("LINK_PREVIEW_TIMEOUT", 5*time.Second))
+	preview, fetchErr := getPreviewFetcher().fetchPreview(ctx, rawURL)
+	cancel()
+
+	preview.URL = rawURL
+	preview.FetchedAt = time.Now()
+	preview.Failed = fetchErr != nil
+
+	if err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "url"}},
+		DoUpdates: clause.AssignmentColumns([]string{"title", "description", "image_url", "site_name", "failed", "fetched_at"}),
+	}).Create(&preview).Error; err != nil {
+		return nil, err
+	}
+
+	if preview.Failed {
+		return nil, nil
+	}
+	return &preview, nil
+}
+
+// unfurlLater queues message for a link preview, which a worker attaches
+// before sending message_updated. Disappearing messages are skipped, so their
+// links are neither fetched nor kept in the cache. When the queue is full the
+// message simply goes without a preview.
+func unfurlLater(hub *Hub, conversation models.Conversation, message models.Message) {
+	if message.Type != models.TextMessage || message.ExpiresAt != nil || message.LinkPreviewID != nil {
+		return
+	}
+	link := firstPreviewableURL(message.Content)
+	for _, entity := range message.Formatting {
+		if link == "" && entity.Type == "text_link" {
+			link = firstPreviewableURL(entity.URL)
+		}
+	}
+	if link == "" {
+		return
+	}
+
+	// A fixed pool of workers bounds both the fetches and the goroutines
+	unfurlWorkersOnce.Do(func() {
+		for range linkPreviewConcurrency {
+			go func() {
+				for job := range unfurlQueue {
+					job.run()
+				}
+			}()
+		}
+	})
+
+	select {
+	case unfurlQueue <- unfurlJob{hub: hub, conversation: conversation, message: message, link: link}:
+	default:
+		log.Printf("Link preview queue full, skipping message %d", message.ID)
+	}
+}
+
+func (job unfurlJob) run() {
+	preview, err := linkPreviewFor(job.link)
+	if err != nil {
+		log.Printf("Failed to store link preview for message %d: %v", job.message.ID, err)
+		return
+	}
+	if preview == nil {
+		return
+	}
+
+	result := database.DB.Model(&models.Message{}).
+		Where("id = ? AND link_preview_id IS NULL", job.message.ID).
+		Update("link_preview_id", preview.ID)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+
+	var updated models.Message
+	if err := database.DB.Preload("Sender").Preload("LinkPreview").First(&updated, job.message.ID).Error; err != nil {
+		return
+	}
+	updated.Entities = loadEntities(updated)
+
+	sendWithMaskedUser(job.hub, messageAudience(job.conversation, updated.SenderID), updated.Sender, func(sender models.User) map[string]interface{} {
+		updated.Sender = sender
+		return map[string]interface{}{
+			"type":    "message_updated",
+			"message": updated,
+		}
+	})
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
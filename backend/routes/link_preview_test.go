@@ -0,0 +1,142 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// allowOnly lets a test fetcher reach the given servers and nothing else,
+// standing in for the public address check on loopback test servers.
+func allowOnly(t *testing.T, servers ...*httptest.Server) func(netip.AddrPort) bool {
+	t.Helper()
+
+	allowed := map[netip.AddrPort]bool{}
+	for _, server := range servers {
+		parsed, err := url.Parse(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrPort, err := netip.ParseAddrPort(parsed.Host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		allowed[addrPort] = true
+	}
+	return func(addrPort netip.AddrPort) bool {
+		return allowed[netip.AddrPortFrom(addrPort.Addr().Unmap(), addrPort.Port())]
+	}
+}
+
+func TestLinkFetcherBlocksRedirectToPrivateAddress(t *testing.T) {
+	var internalHits atomic.Int32
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		internalHits.Add(1)
+	}))
+	defer internal.Close()
+
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL+"/admin", http.StatusFound)
+	}))
+	defer public.Close()
+
+	fetcher := newLinkFetcher(allowOnly(t, public), time.Second, linkPreviewMaxBytes)
+	_, _, _, err := fetcher.get(context.Background(), public.URL, "text/html")
+	if !errors.Is(err, errBlockedAddress) {
+		t.Fatalf("redirect to a blocked address: err = %v, want %v", err, errBlockedAddress)
+	}
+	if internalHits.Load() != 0 {
+		t.Error("redirect target was contacted")
+	}
+}
+
+func TestLinkFetcherChecksResolvedAddress(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer server.Close()
+
+	// A hostname that resolves to a blocked address, as after DNS rebinding,
+	// is refused even though the URL itself carries no IP
+	var checked atomic.Int32
+	allow := func(addrPort netip.AddrPort) bool {
+		checked.Add(1)
+		return !addrPort.Addr().Unmap().IsLoopback()
+	}
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+
+	fetcher := newLinkFetcher(allow, time.Second, linkPreviewMaxBytes)
+	_, _, _, err := fetcher.get(context.Background(), "http://localhost"+port, "text/html")
+	if !errors.Is(err, errBlockedAddress) {
+		t.Fatalf("hostname resolving to loopback: err = %v, want %v", err, errBlockedAddress)
+	}
+	if checked.Load() == 0 {
+		t.Error("resolved address was never checked")
+	}
+	if hits.Load() != 0 {
+		t.Error("server behind the blocked address was contacted")
+	}
+}
+
+func TestLinkFetcherCapsBodySize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(strings.Repeat("a", 4096)))
+	}))
+	defer server.Close()
+
+	fetcher := newLinkFetcher(allowOnly(t, server), time.Second, 1024)
+	body, _, mediaType, err := fetcher.get(context.Background(), server.URL, "text/html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body) != 1024 {
+		t.Errorf("read %d bytes, want the 1024 byte cap", len(body))
+	}
+	if mediaType != "text/html" {
+		t.Errorf("media type = %q, want text/html", mediaType)
+	}
+}
+
+func TestLinkFetcherTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	fetcher := newLinkFetcher(allowOnly(t, server), 100*time.Millisecond, linkPreviewMaxBytes)
+	start := time.Now()
+	if _, _, _, err := fetcher.get(context.Background(), server.URL, "text/html"); err == nil {
+		t.Fatal("fetch of a stalled server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("fetch gave up after %s, want about the 100ms timeout", elapsed)
+	}
+}
+
+func TestIsPublicAddrPortBlocksIPv4Tunnels(t *testing.T) {
+	for _, address := range []string{
+		"[2002:7f00:1::]:443",    // 6to4 for 127.0.0.1
+		"[2002:a00:1::]:80",      // 6to4 for 10.0.0.1
+		"[2001:0:4136::1]:443",   // Teredo
+		"[::ffff:127.0.0.1]:443", // IPv4-mapped loopback
+	} {
+		if isPublicAddrPort(netip.MustParseAddrPort(address)) {
+			t.Errorf("%s allowed, want blocked", address)
+		}
+	}
+
+	if !isPublicAddrPort(netip.MustParseAddrPort("[2606:4700::1111]:443")) {
+		t.Error("public IPv6 address blocked")
+	}
+}
@@ -0,0 +1,380 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginAttemptStore persists failed login counters. The in-memory store is
+// fine for a single node; use the database store when running several replicas.
+type LoginAttemptStore interface {
+	// Reserve atomically counts an attempt for key and locks it for
+	// lockFor(failures), as if the attempt will fail, unless key is already
+	// locked. The count restarts if the previous failure is older than
+	// window. It returns the record and the lock in place beforehand; when
+	// that lock has not passed yet, nothing was changed.
+	Reserve(key string, now time.Time, window time.Duration, lockFor func(failures int) time.Duration) (*models.LoginAttempt, *time.Time, error)
+	// Lock blocks further attempts for key until the given time.
+	Lock(key string, until time.Time) error
+	// Release takes back an attempt counted by Reserve. When lock is set and
+	// still in place, the lock is restored to previous.
+	Release(key string, lock, previous *time.Time) error
+	// Reset clears the record for key.
+	Reset(key string) error
+}
+
+type loginThrottle struct {
+	store            LoginAttemptStore
+	maxFailures      int
+	maxFailuresPerIP int
+	lockoutBase      time.Duration
+	lockoutMax       time.Duration
+	window           time.Duration
+}
+
+var (
+	throttle     *loginThrottle
+	throttleOnce sync.Once
+)
+
+// getLoginThrottle builds the throttle from the environment on first use:
+// LOGIN_ATTEMPT_STORE (memory|database), LOGIN_MAX_FAILURES, LOGIN_MAX_FAILURES_PER_IP,
+// LOGIN_LOCKOUT_DURATION, LOGIN_LOCKOUT_MAX and LOGIN_ATTEMPT_WINDOW.
+func getLoginThrottle() *loginThrottle {
+	throttleOnce.Do(func() {
+		window := envDuration("LOGIN_ATTEMPT_WINDOW", 15*time.Minute)
+
+		var store LoginAttemptStore
+		if os.Getenv("LOGIN_ATTEMPT_STORE") == "database" {
+			store = &databaseAttemptStore{}
+		} else {
+			store = newMemoryAttemptStore(window)
+		}
+
+		throttle = &loginThrottle{
+			store:            store,
+			maxFailures:      envInt("LOGIN_MAX_FAILURES", 5),
+			maxFailuresPerIP: envInt("LOGIN_MAX_FAILURES_PER_IP", 20),
+			lockoutBase:      envDuration("LOGIN_LOCKOUT_DURATION", time.Minute),
+			lockoutMax:       envDuration("LOGIN_LOCKOUT_MAX", time.Hour),
+			window:           window,
+		}
+	})
+	return throttle
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginReservation is an attempt counted against the IP and the account
+// before the credentials are checked. Counting and locking in one atomic step
+// means parallel requests cannot all pass the lock check: each one sees the
+// lock left by the others. Callers settle it with fail, succeed or release.
+type loginReservation struct {
+	throttle *loginThrottle
+	ip       string
+	keys     []reservedKey
+}
+
+type reservedKey struct {
+	key         string
+	maxFailures int
+	account     bool
+	failures    int        // including this attempt
+	previous    *time.Time // lock in place before the reservation
+	lock        *time.Time // lock set by the reservation, if any
+}
+
+// reserve counts an attempt for ip and email. When either key is locked the
+// attempt is given back and the returned wait is how long to back off.
+func (t *loginThrottle) reserve(ip, email string) (*loginReservation, time.Duration) {
+	now := time.Now()
+	reservation := &loginReservation{throttle: t, ip: ip}
+	var wait time.Duration
+
+	candidates := []reservedKey{
+		{key: ipThrottleKey(ip), maxFailures: t.maxFailuresPerIP},
+		{key: accountThrottleKey(email), maxFailures: t.maxFailures, account: true},
+	}
+	for _, candidate := range candidates {
+		lockFor := func(failures int) time.Duration { return t.backoff(failures, candidate.maxFailures) }
+		attempt, previous, err := t.store.Reserve(candidate.key, now, t.window, lockFor)
+		if err != nil {
+			log.Printf("Failed to record login attempt for %s: %v", candidate.key, err)
+			continue
+		}
+		if previous != nil && now.Before(*previous) {
+			wait = max(wait, previous.Sub(now))
+			continue
+		}
+
+		candidate.failures = attempt.Failures
+		candidate.previous = previous
+		if lockFor(attempt.Failures) > 0 {
+			candidate.lock = attempt.LockedUntil
+		}
+		reservation.keys = append(reservation.keys, candidate)
+	}
+
+	if wait > 0 {
+		reservation.release()
+		return nil, wait
+	}
+	return reservation, 0
+}
+
+// fail keeps the attempt counted and applies backoff or a lockout, measured
+// from now rather than from the reservation.
+func (r *loginReservation) fail(userID *uint) {
+	now := time.Now()
+	for _, key := range r.keys {
+		delay := r.throttle.backoff(key.failures, key.maxFailures)
+		if delay <= 0 {
+			continue
+		}
+
+		if err := r.throttle.store.Lock(key.key, now.Add(delay).Truncate(time.Microsecond)); err != nil {
+			log.Printf("Failed to lock %s: %v", key.key, err)
+			continue
+		}
+
+		if key.failures >= key.maxFailures {
+			var auditUserID *uint
+			if key.account {
+				auditUserID = userID
+			}
+			recordAuditEvent("login_lockout", auditUserID, r.ip,
+				fmt.Sprintf("key=%s failures=%d duration=%s", key.key, key.failures, delay))
+		}
+	}
+}
+
+// succeed clears the account counter after a successful login. The IP
+// attempt is only given back, so one valid account cannot reset the IP
+// counter for an attacker. A lockout that simply runs out is not audited:
+// login_unlock marks the first successful login after a lockout.
+func (r *loginReservation) succeed(userID uint) {
+	for _, key := range r.keys {
+		if !key.account {
+			r.throttle.releaseKey(key)
+			continue
+		}
+
+		if err := r.throttle.store.Reset(key.key); err != nil {
+			log.Printf("Failed to reset login attempts for %s: %v", key.key, err)
+			continue
+		}
+		if key.failures-1 >= key.maxFailures {
+			recordAuditEvent("login_unlock", &userID, r.ip,
+				fmt.Sprintf("key=%s reason=login_succeeded", key.key))
+		}
+	}
+}
+
+// release gives the attempt back without judging it, e.g. when it was refused
+// or its outcome is decided by a later step.
+func (r *loginReservation) release() {
+	for _, key := range r.keys {
+		r.throttle.releaseKey(key)
+	}
+}
+
+func (t *loginThrottle) releaseKey(key reservedKey) {
+	if err := t.store.Release(key.key, key.lock, key.previous); err != nil {
+		log.Printf("Failed to release login attempt for %s: %v", key.key, err)
+	}
+}
+
+// backoff grows exponentially: short delays from the second failure on, then
+// a lockout starting at lockoutBase once maxFailures is reached, capped at lockoutMax.
+func (t *loginThrottle) backoff(failures, maxFailures int) time.Duration {
+	if failures >= maxFailures {
+		return capDuration(t.lockoutBase, failures-maxFailures, t.lockoutMax)
+	}
+	if failures >= 2 {
+		return capDuration(time.Second, failures-2, t.lockoutBase)
+	}
+	return 0
+}
+
+func capDuration(base time.Duration, exponent int, max time.Duration) time.Duration {
+	if exponent > 30 {
+		return max
+	}
+	delay := time.Duration(float64(base) * math.Pow(2, float64(exponent)))
+	if delay > max || delay <= 0 {
+		return max
+	}
+	return delay
+}
+
+// memoryAttemptStore keeps counters in process memory.
+type memoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]*models.LoginAttempt
+}
+
+func newMemoryAttemptStore(window time.Duration) *memoryAttemptStore {
+	store := &memoryAttemptStore{attempts: make(map[string]*models.LoginAttempt)}
+	go store.sweep(window)
+	return store
+}
+
+func (s *memoryAttemptStore) Reserve(key string, now time.Time, window time.Duration, lockFor func(int) time.Duration) (*models.LoginAttempt, *time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = &models.LoginAttempt{Key: key}
+		s.attempts[key] = attempt
+	}
+
+	previous := attempt.LockedUntil
+	if previous == nil || !now.Before(*previous) {
+		if now.Sub(attempt.LastFailureAt) > window {
+			attempt.Failures = 0
+		}
+		attempt.Failures++
+		attempt.LastFailureAt = now
+		if delay := lockFor(attempt.Failures); delay > 0 {
+			until := now.Add(delay).Truncate(time.Microsecond)
+			attempt.LockedUntil = &until
+		}
+	}
+
+	copied := *attempt
+	return &copied, previous, nil
+}
+
+func (s *memoryAttemptStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if attempt, ok := s.attempts[key]; ok {
+		attempt.LockedUntil = &until
+	}
+	return nil
+}
+
+func (s *memoryAttemptStore) Release(key string, lock, previous *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return nil
+	}
+	if attempt.Failures > 0 {
+		attempt.Failures--
+	}
+	if lock != nil && attempt.LockedUntil != nil && attempt.LockedUntil.Equal(*lock) {
+		attempt.LockedUntil = previous
+	}
+	return nil
+}
+
+func (s *memoryAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// sweep drops records that are past the window and no longer locked.
+func (s *memoryAttemptStore) sweep(window time.Duration) {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		s.mu.Lock()
+		for key, attempt := range s.attempts {
+			locked := attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil)
+			if !locked && now.Sub(attempt.LastFailureAt) > window {
+				delete(s.attempts, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// databaseAttemptStore shares counters between replicas through the login_attempts table.
+type databaseAttemptStore struct{}
+
+func (s *databaseAttemptStore) Reserve(key string, now time.Time, window time.Duration, lockFor func(int) time.Duration) (*models.LoginAttempt, *time.Time, error) {
+	var attempt models.LoginAttempt
+	var previous *time.Time
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// The row must exist before it can be locked
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginAttempt{Key: key}).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&attempt).Error; err != nil {
+			return err
+		}
+
+		previous = attempt.LockedUntil
+		if previous != nil && now.Before(*previous) {
+			return nil
+		}
+
+		if now.Sub(attempt.LastFailureAt) > window {
+			attempt.Failures = 0
+		}
+		attempt.Failures++
+		attempt.LastFailureAt = now
+		// Postgres keeps microseconds, and Release compares the stored lock
+		if delay := lockFor(attempt.Failures); delay > 0 {
+			until := now.Add(delay).Truncate(time.Microsecond)
+			attempt.LockedUntil = &until
+		}
+
+		return tx.Model(&models.LoginAttempt{}).Where("key = ?", key).Updates(map[string]interface{}{
+			"failures":        attempt.Failures,
+			"last_failure_at": attempt.LastFailureAt,
+			"locked_until":    attempt.LockedUntil,
+		}).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &attempt, previous, nil
+}
+
+func (s *databaseAttemptStore) Lock(key string, until time.Time) error {
+	return database.DB.Model(&models.LoginAttempt{}).Where("key = ?", key).Update("locked_until", until).Error
+}
+
+func (s *databaseAttemptStore) Release(key string, lock, previous *time.Time) error {
+	updates := map[string]interface{}{"failures": gorm.Expr("GREATEST(failures - 1, 0)")}
+	if lock != nil {
+		// Only undo our own lock; a newer one belongs to another attempt
+		updates["locked_until"] = gorm.Expr(
+			"CASE WHEN locked_until = ? THEN CAST(? AS timestamptz) ELSE locked_until END", *lock, previous)
+	}
+	return database.DB.Model(&models.LoginAttempt{}).Where("key = ?", key).Updates(updates).Error
+}
+
+func (s *databaseAttemptStore) Reset(key string) error {
+	return database.DB.Where("key = ?", key).Delete(&models.LoginAttempt{}).Error
+}
@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"chat-backend/models"
+)
+
+func newTestThrottle() *loginThrottle {
+	return &loginThrottle{
+		store:            &memoryAttemptStore{attempts: map[string]*models.LoginAttempt{}},
+		maxFailures:      5,
+		maxFailuresPerIP: 20,
+		lockoutBase:      time.Minute,
+		lockoutMax:       time.Hour,
+		window:           15 * time.Minute,
+	}
+}
+
+func TestParallelReservationsSeeEachOthersLock(t *testing.T) {
+	throttle := newTestThrottle()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		granted int
+	)
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Different IPs, so only the account key can stop them
+			if attempt, _ := throttle.reserve(fmt.Sprintf("203.0.113.%d", i), "alice@example.com"); attempt != nil {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The first failure is free and the second one starts a backoff, so at
+	// most two guesses can be in flight at once
+	if granted != 2 {
+		t.Fatalf("granted %d parallel attempts, want 2", granted)
+	}
+}
+
+func TestReleasedReservationIsNotCounted(t *testing.T) {
+	throttle := newTestThrottle()
+
+	for range 10 {
+		attempt, wait := throttle.reserve("203.0.113.1", "alice@example.com")
+		if attempt == nil {
+			t.Fatalf("reservation refused for %s after released attempts", wait)
+		}
+		attempt.release()
+	}
+}
+
+func TestFailedReservationsLockTheAccount(t *testing.T) {
+	throttle := newTestThrottle()
+
+	attempt, _ := throttle.reserve("203.0.113.1", "alice@example.com")
+	attempt.fail(nil)
+
+	// The second failure backs off, refusing the next attempt without counting it
+	attempt, _ = throttle.reserve("203.0.113.2", "alice@example.com")
+	attempt.fail(nil)
+
+	if attempt, wait := throttle.reserve("203.0.113.3", "Alice@Example.com "); attempt != nil || wait <= 0 {
+		t.Fatalf("reserve after backoff = %v, %s; want refused", attempt, wait)
+	}
+
+	record := throttle.store.(*memoryAttemptStore).attempts[accountThrottleKey("alice@example.com")]
+	if record.Failures != 2 {
+		t.Errorf("account failures = %d, want 2", record.Failures)
+	}
+	if record := throttle.store.(*memoryAttemptStore).attempts[ipThrottleKey("203.0.113.3")]; record != nil && record.Failures != 0 {
+		t.Errorf("refused attempt was counted against its IP: %d failures", record.Failures)
+	}
+}
+
+func TestSucceedResetsOnlyTheAccount(t *testing.T) {
+	throttle := newTestThrottle()
+	store := throttle.store.(*memoryAttemptStore)
+
+	attempt, _ := throttle.reserve("203.0.113.1", "alice@example.com")
+	attempt.fail(nil)
+
+	attempt, _ = throttle.reserve("203.0.113.1", "bob@example.com")
+	attempt.succeed(1)
+
+	if record := store.attempts[ipThrottleKey("203.0.113.1")]; record == nil || record.Failures != 1 {
+		t.Errorf("IP record after success = %+v, want the earlier failure kept", record)
+	}
+	if record := store.attempts[accountThrottleKey("bob@example.com")]; record != nil {
+		t.Errorf("account record after success = %+v, want it cleared", record)
+	}
+}
@@ -0,0 +1,353 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"chat-backend/models"
+)
+
+// Markdown messages support a small, fixed subset:
+//
+//	**bold**  *italic* or _italic_  ~~strikethrough~~  `code`
+//	[text](https://example.com)
+//	```lang         fenced code block (language optional)
+//	> quote         consecutive quoted lines form one blockquote
+//
+// A backslash escapes the next punctuation character. Inline markers that do
+// not close are kept as literal text, but structural problems such as an
+// unclosed code block or an unsafe link are rejected. The source is rendered
+// to plain text plus entities whose offsets, like mentions, are in UTF-16
+// code units of the plain text.
+const (
+	maxMarkupBytes    = 10000
+	maxMarkupEntities = 100
+	maxMarkupDepth    = 4
+	maxLinkURLLength  = 2048
+)
+
+var codeLanguagePattern = regexp.MustCompile(`^[A-Za-z0-9_+#.\-]{0,20}$`)
+
+type markupRenderer struct {
+	out      strings.Builder
+	offset   int // UTF-16 length of out
+	entities []models.MessageEntity
+}
+
+func (r *markupRenderer) write(s string) {
+	r.out.WriteString(s)
+	r.offset += utf16Len(s)
+}
+
+// wrap records an entity covering whatever render writes.
+func (r *markupRenderer) wrap(entity models.MessageEntity, render func() error) error {
+	start := r.offset
+	if err := render(); err != nil {
+		return err
+	}
+	if r.offset > start {
+		entity.Offset = start
+		entity.Length = r.offset - start
+		r.entities = append(r.entities, entity)
+	}
+	return nil
+}
+
+// renderMarkup checks and renders a markdown message into its plain text and
+// formatting entities.
+func renderMarkup(source string) (string, []models.MessageEntity, error) {
+	if len(source) > maxMarkupBytes {
+		return "", nil, errors.New("message is too long")
+	}
+	if !utf8.ValidString(source) {
+		return "", nil, errors.New("message is not valid UTF-8")
+	}
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	for _, r := range source {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return "", nil, errors.New("message contains control characters")
+		}
+	}
+
+	renderer := &markupRenderer{}
+	lines := strings.Split(source, "\n")
+	for i := 0; i < len(lines); i++ {
+		if i > 0 {
+			renderer.write("\n")
+		}
+		line := lines[i]
+
+		switch {
+		case strings.HasPrefix(line, "```"):
+			end, err := renderer.codeBlock(lines, i)
+			if err != nil {
+				return "", nil, err
+			}
+			i = end
+
+		case strings.HasPrefix(line, ">"):
+			end := i
+			for end+1 < len(lines) && strings.HasPrefix(lines[end+1], ">") {
+				end++
+			}
+			quoted := lines[i : end+1]
+			err := renderer.wrap(models.MessageEntity{Type: "blockquote"}, func() error {
+				for j, quotedLine := range quoted {
+					if j > 0 {
+						renderer.write("\n")
+					}
+					quotedLine = strings.TrimPrefix(strings.TrimPrefix(quotedLine, ">"), " ")
+					if err := renderer.inline([]rune(quotedLine), 0); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return "", nil, err
+			}
+			i = end
+
+		default:
+			if err := renderer.inline([]rune(line), 0); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+
+	if len(renderer.entities) > maxMarkupEntities {
+		return "", nil, errors.New("message has too much formatting")
+	}
+
+	sort.SliceStable(renderer.entities, func(i, j int) bool {
+		return renderer.entities[i].Offset < renderer.entities[j].Offset
+	})
+	return renderer.out.String(), renderer.entities, nil
+}
+
+// literal writes text unparsed as a single entity.
+func (r *markupRenderer) literal(entity models.MessageEntity, text string) {
+	if text == "" {
+		return
+	}
+	entity.Offset = r.offset
+	r.write(text)
+	entity.Length = r.offset - entity.Offset
+	r.entities = append(r.entities, entity)
+}
+
+// codeBlock renders the fenced block opening at lines[start] and returns the
+// index of its closing fence. "```code```" on one line is a block too.
+func (r *markupRenderer) codeBlock(lines []string, start int) (int, error) {
+	opening := strings.TrimPrefix(lines[start], "```")
+	if body, ok := strings.CutSuffix(opening, "```"); ok && body != "" {
+		r.literal(models.MessageEntity{Type: "pre"}, body)
+		return start, nil
+	}
+
+	language := strings.TrimSpace(opening)
+	if !codeLanguagePattern.MatchString(language) {
+		return 0, fmt.Errorf("invalid code block language %q", language)
+	}
+
+	for end := start + 1; end < len(lines); end++ {
+		if strings.TrimSpace(lines[end]) == "```" {
+			r.literal(models.MessageEntity{Type: "pre", Language: language}, strings.Join(lines[start+1:end], "\n"))
+			return end, nil
+		}
+	}
+	return 0, errors.New("code block is not closed")
+}
+
+// inline renders one line of inline markup. Past maxMarkupDepth markers are
+// kept as text, which bounds the recursion.
+func (r *markupRenderer) inline(line []rune, depth int) error {
+	for i := 0; i < len(line); {
+		char := line[i]
+
+		if char == '\\' && i+1 < len(line) && (unicode.IsPunct(line[i+1]) || unicode.IsSymbol(line[i+1])) {
+			r.write(string(line[i+1]))
+			i += 2
+			continue
+		}
+
+		if char == '`' {
+			if end := indexRuneFrom(line, '`', i+1); end > i+1 {
+				r.literal(models.MessageEntity{Type: "code"}, string(line[i+1:end]))
+				i = end + 1
+				continue
+			}
+		}
+
+		if char == '[' && depth < maxMarkupDepth {
+			if textEnd, urlEnd, ok := matchLink(line, i); ok {
+				link := string(line[textEnd+2 : urlEnd])
+				if !validLinkURL(link) {
+					return fmt.Errorf("invalid link %q", link)
+				}
+				err := r.wrap(models.MessageEntity{Type: "text_link", URL: link}, func() error {
+					return r.inline(line[i+1:textEnd], depth+1)
+				})
+				if err != nil {
+					return err
+				}
+				i = urlEnd + 1
+				continue
+			}
+		}
+
+		if marker, entityType := delimiterAt(line, i); marker != "" && depth < maxMarkupDepth {
+			if end := closingDelimiter(line, i+len(marker), marker); end >= 0 {
+				inner := line[i+len(marker) : end]
+				err := r.wrap(models.MessageEntity{Type: entityType}, func() error {
+					return r.inline(inner, depth+1)
+				})
+				if err != nil {
+					return err
+				}
+				i = end + len(marker)
+				continue
+			}
+		}
+
+		r.write(string(char))
+		i++
+	}
+	return nil
+}
+
+// delimiterAt returns the emphasis marker opening at line[i], if any. A
+// marker must be followed by a non-space, and single markers must not be
+// inside a word so snake_case and 2*3*4 stay as they are.
+func delimiterAt(line []rune, i int) (string, string) {
+	next := func(n int) rune {
+		if i+n < len(line) {
+			return line[i+n]
+		}
+		return ' '
+	}
+
+	switch {
+	case line[i] == '*' && next(1) == '*' && !unicode.IsSpace(next(2)):
+		return "**", "bold"
+	case line[i] == '~' && next(1) == '~' && !unicode.IsSpace(next(2)):
+		return "~~", "strikethrough"
+	case line[i] == '*' && next(1) != '*' && !unicode.IsSpace(next(1)) && (i == 0 || !isWordRune(line[i-1])):
+		return "*", "italic"
+	case line[i] == '_' && !unicode.IsSpace(next(1)) && (i == 0 || !isWordRune(line[i-1])):
+		return "_", "italic"
+	}
+	return "", ""
+}
+
+// closingDelimiter finds the marker closing an emphasis span with non-empty
+// content starting at from, or -1.
+func closingDelimiter(line []rune, from int, marker string) int {
+	markerRunes := []rune(marker)
+	for j := from + 1; j+len(markerRunes) <= len(line); j++ {
+		if string(line[j:j+len(markerRunes)]) != marker || unicode.IsSpace(line[j-1]) || line[j-1] == '\\' {
+			continue
+		}
+		after := ' '
+		if j+len(markerRunes) < len(line) {
+			after = line[j+len(markerRunes)]
+		}
+		if len(markerRunes) == 1 {
+			// A single marker next to the same character belongs to a double one
+			if after == markerRunes[0] || line[j-1] == markerRunes[0] {
+				continue
+			}
+			if isWordRune(after) {
+				continue
+			}
+		}
+		return j
+	}
+	return -1
+}
+
+// matchLink matches [text](url) at line[start], returning the positions of
+// "]" and ")".
+func matchLink(line []rune, start int) (int, int, bool) {
+	textEnd := indexRuneFrom(line, ']', start+1)
+	if textEnd <= start+1 || textEnd+1 >= len(line) || line[textEnd+1] != '(' {
+		return 0, 0, false
+	}
+	if strings.ContainsRune(string(line[start+1:textEnd]), '[') {
+		return 0, 0, false
+	}
+	urlEnd := indexRuneFrom(line, ')', textEnd+2)
+	if urlEnd <= textEnd+2 || strings.ContainsFunc(string(line[textEnd+2:urlEnd]), unicode.IsSpace) {
+		return 0, 0, false
+	}
+	return textEnd, urlEnd, true
+}
+
+// validLinkURL allows absolute http(s) and mailto links only, so markup can
+// never produce javascript: or data: links.
+func validLinkURL(link string) bool {
+	if len(link) > maxLinkURLLength {
+		return false
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	switch parsed.Scheme {
+	case "http", "https":
+		return parsed.Host != ""
+	case "mailto":
+		return parsed.Opaque != ""
+	}
+	return false
+}
+
+func indexRuneFrom(line []rune, target rune, from int) int {
+	for i := from; i < len(line); i++ {
+		if line[i] == target {
+			return i
+		}
+	}
+	return -1
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// applyMarkup renders a markdown message in place: Content becomes the plain
+// text, Markup keeps the source and Formatting the styled ranges. Plain
+// messages are left as they are.
+func applyMarkup(message *models.Message) error {
+	switch message.Format {
+	case "", models.FormatPlain:
+		message.Format = models.FormatPlain
+		return nil
+	case models.FormatMarkdown:
+	default:
+		return errors.New("unknown message format")
+	}
+
+	plain, formatting, err := renderMarkup(message.Content)
+	if err != nil {
+		return err
+	}
+	message.Markup = message.Content
+	message.Content = plain
+	message.Formatting = formatting
+	return nil
+}
+
+// messageEntities merges a message's formatting with its mention ranges,
+// ordered by offset.
+func messageEntities(message models.Message, mentions []models.MessageMention) []models.MessageEntity {
+	entities := append(append([]models.MessageEntity(nil), message.Formatting...), mentionEntities(mentions)...)
+	sort.SliceStable(entities, func(i, j int) bool { return entities[i].Offset < entities[j].Offset })
+	return entities
+}
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"chat-backend/models"
+)
+
+// entityStrings formats entities as "type offset length [url|language]".
+func entityStrings(entities []models.MessageEntity) []string {
+	var formatted []string
+	for _, entity := range entities {
+		s := fmt.Sprintf("%s %d %d", entity.Type, entity.Offset, entity.Length)
+		if entity.URL != "" {
+			s += " " + entity.URL
+		}
+		if entity.Language != "" {
+			s += " " + entity.Language
+		}
+		formatted = append(formatted, s)
+	}
+	return formatted
+}
+
+func TestRenderMarkup(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		plain    string
+		entities []string
+	}{
+		{"plain", "hello", "hello", nil},
+		{"emphasis", "**bold** and *it* and _it_", "bold and it and it", []string{"bold 0 4", "italic 9 2", "italic 16 2"}},
+		{"strikethrough", "~~gone~~", "gone", []string{"strikethrough 0 4"}},
+		{"nesting", "**bold _it_**", "bold it", []string{"bold 0 7", "italic 5 2"}},
+		{"escapes", `\*not italic\* \_ \\`, `*not italic* _ \`, nil},
+		{"markers inside words", "snake_case_name 2*3*4", "snake_case_name 2*3*4", nil},
+		{"unterminated emphasis", "**open *half ~~left", "**open *half ~~left", nil},
+		{"marker before a space", "** not bold**", "** not bold**", nil},
+		{"code span", "run `a *b*` now", "run a *b* now", []string{"code 4 5"}},
+		{"unterminated code span", "an `open span", "an `open span", nil},
+		{"empty code span", "empty `` span", "empty `` span", nil},
+		{"code fence", "```go\nfmt.Println()\n```", "fmt.Println()", []string{"pre 0 13 go"}},
+		{"code fence between lines", "see\n```\n**code**\n```\nafter", "see\n**code**\nafter", []string{"pre 4 8"}},
+		{"one-line fence", "```x```", "x", []string{"pre 0 1"}},
+		{"link", "see [site](https://example.com)", "see site", []string{"text_link 4 4 https://example.com"}},
+		{"mailto link", "[mail](mailto:a@example.com)", "mail", []string{"text_link 0 4 mailto:a@example.com"}},
+		{"not a link", "[text] (https://example.com)", "[text] (https://example.com)", nil},
+		{"blockquote", "> quoted\n> *more*\nafter", "quoted\nmore\nafter", []string{"blockquote 0 11", "italic 7 4"}},
+		{"CRLF", "a\r\n**b**", "a\nb", []string{"bold 2 1"}},
+		{"surrogate pair before", "😀 **hi**", "😀 hi", []string{"bold 3 2"}},
+		{"surrogate pair inside", "**😀**x `é😀`", "😀x é😀", []string{"bold 0 2", "code 4 3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain, entities, err := renderMarkup(tt.source)
+			if err != nil {
+				t.Fatalf("renderMarkup(%q): %v", tt.source, err)
+			}
+			if plain != tt.plain {
+				t.Errorf("renderMarkup(%q) plain = %q, want %q", tt.source, plain, tt.plain)
+			}
+			if got := entityStrings(entities); !slices.Equal(got, tt.entities) {
+				t.Errorf("renderMarkup(%q) entities = %q, want %q", tt.source, got, tt.entities)
+			}
+		})
+	}
+}
+
+func TestRenderMarkupRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"unclosed code fence", "```\ncode"},
+		{"invalid code language", "```not a language\n```"},
+		{"javascript link", "[x](javascript:alert(1))"},
+		{"relative link", "[x](/settings)"},
+		{"link without host", "[x](https:///path)"},
+		{"link URL too long", "[x](https://example.com/" + strings.Repeat("a", maxLinkURLLength) + ")"},
+		{"control character", "a\x00b"},
+		{"invalid UTF-8", "a\xffb"},
+		{"too long", strings.Repeat("a", maxMarkupBytes+1)},
+		{"too many entities", strings.Repeat("*a* ", maxMarkupEntities+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := renderMarkup(tt.source); err == nil {
+				t.Errorf("renderMarkup(%.40q) succeeded, want an error", tt.source)
+			}
+		})
+	}
+}
+
+func TestRenderMarkupAcceptsTheLimits(t *testing.T) {
+	for _, source := range []string{
+		strings.Repeat("a", maxMarkupBytes),
+		strings.Repeat("*a* ", maxMarkupEntities),
+	} {
+		if _, _, err := renderMarkup(source); err != nil {
+			t.Errorf("renderMarkup(%.40q): %v", source, err)
+		}
+	}
+}
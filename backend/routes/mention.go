@@ -0,0 +1,145 @@
+package routes
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	"chat-backend/database"
+	"chat-backend/models"
+)
+
+// mentionPattern matches @name when it is not part of a word or an email
+// address. Trailing dots and dashes are left out so "thanks @bob." works.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@.])(@[\p{L}\p{N}_](?:[\p{L}\p{N}_.\-]*[\p{L}\p{N}_])?)`)
+
+// mentionToken is one @token found in message content. Offset and length are
+// in UTF-16 code units.
+type mentionToken struct {
+	name   string
+	offset int
+	length int
+}
+
+func parseMentions(content string) []mentionToken {
+	var tokens []mentionToken
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+		start, end := match[2], match[3]
+		tokens = append(tokens, mentionToken{
+			name:   content[start+1 : end],
+			offset: utf16Len(content[:start]),
+			length: utf16Len(content[start:end]),
+		})
+	}
+	return tokens
+}
+
+// resolveMentions turns @tokens into mention rows for the conversation's
+// participants. Unknown names, the sender and users who blocked the sender
+// are skipped; each user is mentioned at most once per token. @here only
+// reaches participants for whom connected is true, whatever status they show.
+func resolveMentions(content string, senderID uint, participants []models.User, blockers map[uint]bool, connected func(uint) bool) []models.MessageMention {
+	var mentions []models.MessageMention
+	for _, token := range parseMentions(content) {
+		kind := models.MentionUser
+		switch strings.ToLower(token.name) {
+		case "all":
+			kind = models.MentionAll
+		case "here":
+			kind = models.MentionHere
+		}
+
+		for _, participant := range participants {
+			if participant.ID == senderID || blockers[participant.ID] {
+				continue
+			}
+
+			switch kind {
+			case models.MentionUser:
+				if !strings.EqualFold(participant.Username, token.name) {
+					continue
+				}
+			case models.MentionHere:
+				if !connected(participant.ID) {
+					continue
+				}
+			}
+
+			mentions = append(mentions, models.MessageMention{
+				UserID: participant.ID,
+				Kind:   kind,
+				Offset: token.offset,
+				Length: token.length,
+			})
+		}
+	}
+	return mentions
+}
+
+// mentionEntities collapses mention rows into entity ranges; @all and @here
+// become a single entity however many users they resolved to.
+func mentionEntities(mentions []models.MessageMention) []models.MessageEntity {
+	var entities []models.MessageEntity
+	seen := map[int]bool{}
+	for _, mention := range mentions {
+		if mention.Kind == models.MentionUser {
+			userID := mention.UserID
+			entities = append(entities, models.MessageEntity{
+				Type:   "mention",
+				Offset: mention.Offset,
+				Length: mention.Length,
+				UserID: &userID,
+			})
+			continue
+		}
+		if seen[mention.Offset] {
+			continue
+		}
+		seen[mention.Offset] = true
+		entities = append(entities, models.MessageEntity{
+			Type:   "mention_" + string(mention.Kind),
+			Offset: mention.Offset,
+			Length: mention.Length,
+		})
+	}
+	return entities
+}
+
+// attachEntities loads the mentions of messages and fills in their entities,
+// together with any formatting.
+func attachEntities(messages []models.Message) {
+	if len(messages) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+	}
+
+	var mentions []models.MessageMention
+	database.DB.Where("message_id IN ?", ids).Order("\"offset\", id").Find(&mentions)
+
+	byMessage := map[uint][]models.MessageMention{}
+	for _, mention := range mentions {
+		byMessage[mention.MessageID] = append(byMessage[mention.MessageID], mention)
+	}
+	for i := range messages {
+		messages[i].Entities = messageEntities(messages[i], byMessage[messages[i].ID])
+	}
+}
+
+// loadEntities returns the entities of a single message.
+func loadEntities(message models.Message) []models.MessageEntity {
+	messages := []models.Message{message}
+	attachEntities(messages)
+	return messages[0].Entities
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
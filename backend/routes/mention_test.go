@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"testing"
+
+	"chat-backend/models"
+)
+
+func TestResolveMentionsHereUsesConnections(t *testing.T) {
+	participants := []models.User{
+		{ID: 1, Username: "sender"},
+		{ID: 2, Username: "connected_invisible", Status: "offline"},
+		{ID: 3, Username: "stale_online", Status: "online"},
+		{ID: 4, Username: "blocker"},
+	}
+	connected := func(id uint) bool { return id != 3 }
+
+	mentions := resolveMentions("hey @here", 1, participants, map[uint]bool{4: true}, connected)
+
+	if len(mentions) != 1 || mentions[0].UserID != 2 || mentions[0].Kind != models.MentionHere {
+		t.Fatalf("@here resolved to %+v, want only the connected participant 2", mentions)
+	}
+}
@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"chat-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// checkCanPost verifies that senderID takes part in the conversation and,
+// for direct conversations, that no block exists in either direction.
+func checkCanPost(senderID uint, conversation models.Conversation) error {
+	isParticipant := false
+	for _, participant := range conversation.Participants {
+		if participant.ID == senderID {
+			isParticipant = true
+		} else if conversation.Type == models.DirectMessage && isBlockedEitherWay(senderID, participant.ID) {
+			// Blocks apply in both directions for direct messages
+			return &actionError{http.StatusForbidden, "You cannot message this user"}
+		}
+	}
+	if !isParticipant {
+		return &actionError{http.StatusForbidden, "Access denied"}
+	}
+	return nil
+}
+
+// visibleMessages limits a messages query to what viewerID can see: messages
+// in conversations they take part in, not from senders they blocked and not
+// expired.
+func visibleMessages(viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.
+			Joins("JOIN conversation_participants viewer ON viewer.conversation_id = messages.conversation_id AND viewer.user_id = ?", viewerID).
+			Where("messages.sender_id NOT IN (?)", blockedSenderSubquery(viewerID))
+		// Scopes added from inside a scope are not applied, so call it directly
+		return unexpiredMessages(db)
+	}
+}
+
+// saveMessage stores a new message with its mentions and bumps the
+// conversation, using tx so callers can combine it with other writes. The
+// conversation's disappearing timer applies to everything but system messages,
+// and @here reaches the participants connected to hub.
+func saveMessage(hub *Hub, tx *gorm.DB, message *models.Message, conversation models.Conversation) ([]models.MessageMention, error) {
+	if message.Format == "" {
+		message.Format = models.FormatPlain
+	}
+
+	var mentions []models.MessageMention
+	if message.Type != models.SystemMessage {
+		message.ExpiresAt = conversation.MessageExpiry(time.Now())
+		mentions = resolveMentions(message.Content, message.SenderID, conversation.Participants, blockerIDsOf(message.SenderID), hub.IsConnected)
+	}
+
+	if err := tx.Create(message).Error; err != nil {
+		return nil, err
+	}
+
+	if len(mentions) > 0 {
+		for i := range mentions {
+			mentions[i].MessageID = message.ID
+		}
+		if err := tx.Create(&mentions).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Model(&models.Conversation{}).
+		Where("id = ?", conversation.ID).
+		Update("updated_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+
+	return mentions, nil
+}
+
+// deliverMessage sends new_message to the participants who have not blocked
+// the sender, plus a mention event to mentioned users so clients can notify
+// even when the conversation is muted. The sender's presence is masked per
+// recipient.
+func deliverMessage(hub *Hub, conversation models.Conversation, message models.Message, mentions []models.MessageMention) {
+	sendWithMaskedUser(hub, messageAudience(conversation, message.SenderID), message.Sender, func(sender models.User) map[string]interface{} {
+		message.Sender = sender
+		return map[string]interface{}{
+			"type":    "new_message",
+			"message": message,
+		}
+	})
+
+	if len(mentions) > 0 {
+		mentioned := map[uint]bool{}
+		for _, mention := range mentions {
+			mentioned[mention.UserID] = true
+		}
+		sendWithMaskedUser(hub, mapKeys(mentioned), message.Sender, func(sender models.User) map[string]interface{} {
+			message.Sender = sender
+			return map[string]interface{}{
+				"type":            "mention",
+				"conversation_id": message.ConversationID,
+				"message":         message,
+			}
+		})
+	}
+}
+
+// messageAudience returns the participants who can see messages from senderID.
+func messageAudience(conversation models.Conversation, senderID uint) []uint {
+	blockers := blockerIDsOf(senderID)
+
+	var ids []uint
+	for _, participant := range conversation.Participants {
+		if !blockers[participant.ID] {
+			ids = append(ids, participant.ID)
+		}
+	}
+	return ids
+}
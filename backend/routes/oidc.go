@@ -0,0 +1,495 @@
+package routes
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"chat-backend/config"
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcFlowCookie   = "oidc_flow"
+	oidcFlowAudience = "go-chat/oidc-flow"
+	oidcFlowTTL      = 10 * time.Minute
+)
+
+var (
+	errOIDCEmailNotVerified     = errors.New("identity provider did not return a verified email")
+	errOIDCProvisioningDisabled = errors.New("no account is linked to this identity")
+
+	oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+	usernameInvalidChars = regexp.MustCompile(`[^a-z0-9_.-]+`)
+)
+
+// oidcProvider holds the discovered endpoints and cached signing keys of the
+// identity provider configured through OIDC_ISSUER.
+type oidcProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       string
+
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	DiscoveredIssuer      string `json:"issuer"`
+
+	mu            sync.Mutex
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+var (
+	oidc   *oidcProvider
+	oidcMu sync.Mutex
+)
+
+// getOIDCProvider runs discovery on first use. Failures are not cached so a
+// provider that was briefly unavailable is retried on the next login.
+func getOIDCProvider() (*oidcProvider, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	if oidc != nil {
+		return oidc, nil
+	}
+
+	issuer := strings.TrimSuffix(os.Getenv("OIDC_ISSUER"), "/")
+	if issuer == "" {
+		return nil, errors.New("OIDC is not configured")
+	}
+
+	provider := &oidcProvider{
+		issuer:       issuer,
+		clientID:     os.Getenv("OIDC_CLIENT_ID"),
+		clientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		redirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		scopes:       os.Getenv("OIDC_SCOPES"),
+	}
+	if provider.scopes == "" {
+		provider.scopes = "openid email profile"
+	}
+	if provider.clientID == "" || provider.redirectURL == "" {
+		return nil, errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required")
+	}
+
+	if err := fetchJSON(issuer+"/.well-known/openid-configuration", provider); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(provider.DiscoveredIssuer, "/") != issuer {
+		return nil, fmt.Errorf("OIDC discovery returned issuer %q, expected %q", provider.DiscoveredIssuer, issuer)
+	}
+
+	oidc = provider
+	return oidc, nil
+}
+
+// OIDCLogin starts the authorization-code flow with PKCE by redirecting the
+// browser to the identity provider.
+func OIDCLogin(c *gin.Context) {
+	provider, err := getOIDCProvider()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Single sign-on is not available"})
+		return
+	}
+
+	state, err1 := randomURLString(32)
+	nonce, err2 := randomURLString(32)
+	verifier, err3 := randomURLString(32)
+	if err1 != nil || err2 != nil || err3 != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	// The verifier never leaves the browser cookie, only its hash goes to the provider
+	flowToken, err := config.SignToken(jwt.MapClaims{
+		"state":         state,
+		"nonce":         nonce,
+		"code_verifier": verifier,
+		"exp":           time.Now().Add(oidcFlowTTL).Unix(),
+	}, oidcFlowAudience)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcFlowCookie, flowToken, int(oidcFlowTTL.Seconds()), "/", "", config.IsProduction(), true)
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", provider.clientID)
+	params.Set("redirect_uri", provider.redirectURL)
+	params.Set("scope", provider.scopes)
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	c.Redirect(http.StatusFound, provider.AuthorizationEndpoint+separator+params.Encode())
+}
+
+// OIDCCallback completes the flow: it checks state, redeems the code, verifies
+// the ID token and issues a regular go-chat token for the linked user.
+//
+// Local TOTP is not asked for, even when the account has 2FA enabled: the
+// identity provider authenticated the user and is where a second factor for
+// SSO belongs. Accounts are only linked by verified email, and the login is
+// audited.
+func OIDCCallback(c *gin.Context) {
+	provider, err := getOIDCProvider()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Single sign-on is not available"})
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login was not completed: " + errCode})
+		return
+	}
+
+	flowToken, err := c.Cookie(oidcFlowCookie)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login session not found or expired"})
+		return
+	}
+	c.SetCookie(oidcFlowCookie, "", -1, "/", "", config.IsProduction(), true)
+
+	flow, err := config.ParseToken(flowToken, oidcFlowAudience)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login session not found or expired"})
+		return
+	}
+
+	state, _ := flow["state"].(string)
+	if subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
+		return
+	}
+
+	verifier, _ := flow["code_verifier"].(string)
+	idToken, err := provider.exchangeCode(c.Query("code"), verifier)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to redeem authorization code"})
+		return
+	}
+
+	nonce, _ := flow["nonce"].(string)
+	claims, err := provider.verifyIDToken(idToken, nonce)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid ID token"})
+		return
+	}
+
+	user, err := resolveOIDCUser(provider.issuer, claims)
+	if err != nil {
+		if errors.Is(err, errOIDCEmailNotVerified) || errors.Is(err, errOIDCProvisioningDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return
+	}
+
+	recordAuditEvent("oidc_login", &user.ID, c.ClientIP(), "issuer="+provider.issuer)
+
+	token, err := generateToken(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	// Browser-based clients get the token in the URL fragment so it is not sent to servers
+	if redirect := os.Getenv("OIDC_POST_LOGIN_REDIRECT"); redirect != "" {
+		c.Redirect(http.StatusFound, redirect+"#token="+url.QueryEscape(token))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":  ownProfile(*user),
+		"token": token,
+	})
+}
+
+func (p *oidcProvider) exchangeCode(code, verifier string) (string, error) {
+	if code == "" || verifier == "" {
+		return "", errors.New("missing code or verifier")
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURL)
+	form.Set("client_id", p.clientID)
+	form.Set("code_verifier", verifier)
+	if p.clientSecret != "" {
+		form.Set("client_secret", p.clientSecret)
+	}
+
+	resp, err := oidcHTTPClient.PostForm(p.TokenEndpoint, form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %d", resp.StatusCode)
+	}
+
+	var body struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+
+	return body.IDToken, nil
+}
+
+func (p *oidcProvider) verifyIDToken(idToken, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, p.keyFunc,
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(p.DiscoveredIssuer),
+		jwt.WithAudience(p.clientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, errors.New("nonce mismatch")
+	}
+
+	return claims, nil
+}
+
+// keyFunc looks up the provider key by kid, refreshing the JWKS at most once
+// a minute when an unknown kid shows up after a provider key rotation.
+func (p *oidcProvider) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(p.keysFetchedAt) < time.Minute {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := fetchJSON(p.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	p.keys = make(map[string]crypto.PublicKey)
+	p.keysFetchedAt = time.Now()
+	for _, jwk := range set.Keys {
+		if key, err := parseJWK(jwk); err == nil {
+			p.keys[jwk["kid"]] = key
+		}
+	}
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func parseJWK(jwk map[string]string) (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch jwk["kty"] {
+	case "RSA":
+		n, err1 := decode(jwk["n"])
+		e, err2 := decode(jwk["e"])
+		if err1 != nil || err2 != nil {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if jwk["crv"] != "P-256" {
+			return nil, errors.New("unsupported curve")
+		}
+		x, err1 := decode(jwk["x"])
+		y, err2 := decode(jwk["y"])
+		if err1 != nil || err2 != nil {
+			return nil, errors.New("invalid EC key")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		x, err := decode(jwk["x"])
+		if err != nil || jwk["crv"] != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid OKP key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, errors.New("unsupported key type")
+}
+
+// resolveOIDCUser finds the user linked to the identity, links an existing
+// user with the same verified email, or provisions a new account.
+func resolveOIDCUser(issuer string, claims jwt.MapClaims) (*models.User, error) {
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+
+	var user models.User
+	err := database.DB.
+		Joins("JOIN user_identities ON user_identities.user_id = users.id").
+		Where("user_identities.issuer = ? AND user_identities.subject = ?", issuer, subject).
+		First(&user).Error
+	if err == nil {
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	email, _ := claims["email"].(string)
+	if email == "" || !claimIsTrue(claims["email_verified"]) {
+		return nil, errOIDCEmailNotVerified
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("LOWER(email) = LOWER(?)", email).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if os.Getenv("OIDC_AUTO_PROVISION") == "false" {
+				return errOIDCProvisioningDisabled
+			}
+			user, err = provisionOIDCUser(tx, email, claims)
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:  user.ID,
+			Issuer:  issuer,
+			Subject: subject,
+			Email:   email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func provisionOIDCUser(tx *gorm.DB, email string, claims jwt.MapClaims) (models.User, error) {
+	base, _ := claims["preferred_username"].(string)
+	if base == "" {
+		base = strings.SplitN(email, "@", 2)[0]
+	}
+	base = usernameInvalidChars.ReplaceAllString(strings.ToLower(base), "")
+	if len(base) < 3 {
+		base = "user"
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	username := base
+	for i := 0; ; i++ {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return models.User{}, err
+		}
+		if count == 0 && !isReservedUsername(username) {
+			break
+		}
+		suffix, err := randomURLString(3)
+		if err != nil || i > 10 {
+			return models.User{}, errors.New("failed to generate a unique username")
+		}
+		username = base + "_" + strings.ToLower(suffix)
+	}
+
+	// SSO users log in through the provider; the local password is random and unknown
+	password, err := randomURLString(32)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user := models.User{
+		Username: username,
+		Email:    email,
+		Status:   "offline",
+		LastSeen: time.Now(),
+	}
+	if err := user.HashPassword(password); err != nil {
+		return models.User{}, err
+	}
+	if err := tx.Create(&user).Error; err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+func claimIsTrue(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+func fetchJSON(url string, target interface{}) error {
+	resp, err := oidcHTTPClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(target)
+}
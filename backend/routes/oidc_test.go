@@ -0,0 +1,241 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"chat-backend/config"
+	"chat-backend/database"
+	"chat-backend/scripts/mock_oidc/mockoidc"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcTest drives OIDCLogin and OIDCCallback against the mock provider.
+type oidcTest struct {
+	t      *testing.T
+	router *gin.Engine
+}
+
+func newOIDCTest(t *testing.T, identity mockoidc.Identity) *oidcTest {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(nil)
+	issuer := "http://" + server.Listener.Addr().String()
+	provider, err := mockoidc.New(issuer, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Config.Handler = provider.Handler()
+	server.Start()
+	t.Cleanup(server.Close)
+
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("JWT_KEYS_DIR", "")
+	t.Setenv("OIDC_ISSUER", issuer)
+	t.Setenv("OIDC_CLIENT_ID", "go-chat")
+	t.Setenv("OIDC_REDIRECT_URL", "http://chat.test/api/v1/auth/oidc/callback")
+	t.Setenv("OIDC_POST_LOGIN_REDIRECT", "")
+	if err := config.LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Discovery is cached per process, so each test starts from scratch
+	resetOIDC := func() {
+		oidcMu.Lock()
+		oidc = nil
+		oidcMu.Unlock()
+	}
+	resetOIDC()
+	t.Cleanup(resetOIDC)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/login", OIDCLogin)
+	router.GET("/callback", OIDCCallback)
+
+	return &oidcTest{t: t, router: router}
+}
+
+// authorize starts a login and lets the provider approve it, returning the
+// flow cookie, the authorization request and the callback query.
+func (o *oidcTest) authorize() (*http.Cookie, url.Values, url.Values) {
+	o.t.Helper()
+
+	recorder := httptest.NewRecorder()
+	o.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/login", nil))
+	if recorder.Code != http.StatusFound {
+		o.t.Fatalf("login status = %d, want %d: %s", recorder.Code, http.StatusFound, recorder.Body)
+	}
+
+	var flow *http.Cookie
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == oidcFlowCookie {
+			flow = cookie
+		}
+	}
+	if flow == nil {
+		o.t.Fatal("login did not set the flow cookie")
+	}
+
+	location := recorder.Header().Get("Location")
+	authURL, err := url.Parse(location)
+	if err != nil {
+		o.t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(location)
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		o.t.Fatalf("authorize status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		o.t.Fatal(err)
+	}
+
+	return flow, authURL.Query(), callback.Query()
+}
+
+func (o *oidcTest) callback(flow *http.Cookie, query url.Values) *httptest.ResponseRecorder {
+	o.t.Helper()
+
+	request := httptest.NewRequest(http.MethodGet, "/callback?"+query.Encode(), nil)
+	request.AddCookie(flow)
+	recorder := httptest.NewRecorder()
+	o.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// tamperFlow re-signs the flow cookie with one claim replaced, as if the
+// browser had started a different login.
+func (o *oidcTest) tamperFlow(flow *http.Cookie, claim, value string) *http.Cookie {
+	o.t.Helper()
+
+	claims, err := config.ParseToken(flow.Value, oidcFlowAudience)
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	claims[claim] = value
+	token, err := config.SignToken(claims, oidcFlowAudience)
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	return &http.Cookie{Name: oidcFlowCookie, Value: token}
+}
+
+func expectOIDCError(t *testing.T, recorder *httptest.ResponseRecorder, status int, message string) {
+	t.Helper()
+
+	if recorder.Code != status || !strings.Contains(recorder.Body.String(), message) {
+		t.Fatalf("callback = %d %s, want %d with %q", recorder.Code, recorder.Body, status, message)
+	}
+}
+
+func TestOIDCLoginSendsPKCEChallenge(t *testing.T) {
+	o := newOIDCTest(t, mockoidc.Identity{Subject: "sub-1", Email: "alice@example.com"})
+	flow, auth, _ := o.authorize()
+
+	claims, err := config.ParseToken(flow.Value, oidcFlowAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, _ := claims["code_verifier"].(string)
+	challenge := sha256.Sum256([]byte(verifier))
+
+	if auth.Get("code_challenge_method") != "S256" || auth.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+		t.Errorf("authorization request has challenge %q (%s), want the S256 hash of the flow verifier",
+			auth.Get("code_challenge"), auth.Get("code_challenge_method"))
+	}
+	if auth.Get("code_verifier") != "" {
+		t.Error("code verifier was sent to the provider in the authorization request")
+	}
+	if auth.Get("state") != claims["state"] || auth.Get("nonce") != claims["nonce"] {
+		t.Error("authorization request does not carry the flow's state and nonce")
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	o := newOIDCTest(t, mockoidc.Identity{Subject: "sub-1", Email: "alice@example.com"})
+	flow, _, query := o.authorize()
+
+	query.Set("state", "forged")
+	expectOIDCError(t, o.callback(flow, query), http.StatusBadRequest, "Invalid state")
+}
+
+func TestOIDCCallbackRejectsWrongCodeVerifier(t *testing.T) {
+	o := newOIDCTest(t, mockoidc.Identity{Subject: "sub-1", Email: "alice@example.com"})
+	flow, _, query := o.authorize()
+
+	// A code intercepted from another browser cannot be redeemed without
+	// that browser's verifier
+	flow = o.tamperFlow(flow, "code_verifier", "not-the-verifier")
+	expectOIDCError(t, o.callback(flow, query), http.StatusUnauthorized, "Failed to redeem authorization code")
+}
+
+func TestOIDCCallbackRejectsNonceMismatch(t *testing.T) {
+	o := newOIDCTest(t, mockoidc.Identity{Subject: "sub-1", Email: "alice@example.com"})
+	flow, _, query := o.authorize()
+
+	flow = o.tamperFlow(flow, "nonce", "another-login")
+	expectOIDCError(t, o.callback(flow, query), http.StatusUnauthorized, "Invalid ID token")
+}
+
+func TestOIDCCallbackRejectsAccessTokenAsFlow(t *testing.T) {
+	o := newOIDCTest(t, mockoidc.Identity{Subject: "sub-1", Email: "alice@example.com"})
+	_, _, query := o.authorize()
+
+	// A flow token is not an access token and vice versa
+	access, err := generateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flow := &http.Cookie{Name: oidcFlowCookie, Value: access}
+	expectOIDCError(t, o.callback(flow, query), http.StatusBadRequest, "Login session not found or expired")
+}
+
+func TestOIDCLoginSkipsLocalTwoFactor(t *testing.T) {
+	useTestDB(t)
+
+	user := createTestUser(t, "oidc_2fa")
+	database.DB.Model(&user).Updates(map[string]interface{}{"totp_secret": rfc6238Secret, "two_factor_enabled": true})
+
+	o := newOIDCTest(t, mockoidc.Identity{Subject: "sub-oidc-2fa", Email: user.Email})
+	flow, _, query := o.authorize()
+
+	recorder := o.callback(flow, query)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("callback = %d %s, want %d", recorder.Code, recorder.Body, http.StatusOK)
+	}
+
+	var body struct {
+		Token string `json:"token"`
+		User  struct {
+			ID uint `json:"id"`
+		} `json:"user"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.User.ID != user.ID {
+		t.Errorf("signed in as user %d, want the account with the verified email (%d)", body.User.ID, user.ID)
+	}
+	if _, err := config.ParseToken(body.Token, config.AccessTokenAudience); err != nil {
+		t.Errorf("callback did not issue an access token: %v", err)
+	}
+
+	// The code is single-use at the provider
+	expectOIDCError(t, o.callback(flow, query), http.StatusUnauthorized, "Failed to redeem authorization code")
+}
@@ -0,0 +1,230 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxPinsPerConversation keeps the pinned list short enough to stay useful.
+const maxPinsPerConversation = 50
+
+type PinMessageInput struct {
+	MessageID uint `json:"message_id" binding:"required"`
+}
+
+// PinMessage pins a message. In groups only the creator may pin; in direct
+// conversations either participant may.
+func PinMessage(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		return
+	}
+
+	var input PinMessageInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message, err := pinMessage(hub, user.ID, uint(conversationID), input.MessageID)
+	if err != nil {
+		respondActionError(c, err, "Failed to pin message")
+		return
+	}
+
+	pinned := []models.Message{message}
+	maskSenderPresence(pinned, user.ID)
+
+	c.JSON(http.StatusCreated, gin.H{"message": pinned[0]})
+}
+
+// UnpinMessage removes a pin, with the same permissions as pinning.
+func UnpinMessage(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		return
+	}
+	messageID, err := strconv.ParseUint(c.Param("messageId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	if err := unpinMessage(hub, user.ID, uint(conversationID), uint(messageID)); err != nil {
+		respondActionError(c, err, "Failed to unpin message")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message unpinned"})
+}
+
+// GetPinnedMessages lists a conversation's pinned messages, newest pin first.
+func GetPinnedMessages(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	conversationID, ok := participantConversationID(c, user.ID)
+	if !ok {
+		return
+	}
+
+	var messages []models.Message
+	if err := database.DB.
+		Joins("JOIN pinned_messages ON pinned_messages.message_id = messages.id").
+		Where("messages.conversation_id = ?", conversationID).
+		Where("messages.sender_id NOT IN (?)", blockedSenderSubquery(user.ID)).
+		Scopes(unexpiredMessages).
+		Preload("Sender").
+		Preload("Pin.PinnedBy").
+		Preload("LinkPreview").
+		Order("pinned_messages.created_at DESC").
+		Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pinned messages"})
+		return
+	}
+
+	maskSenderPresence(messages, user.ID)
+	attachEntities(messages)
+	attachPolls(messages, user.ID)
+	attachVoicePlays(messages, user.ID)
+	attachStars(messages, user.ID)
+
+	c.JSON(http.StatusOK, gin.H{"pins": messages})
+}
+
+func pinMessage(hub *Hub, userID, conversationID, messageID uint) (models.Message, error) {
+	conversation, err := loadPinnableConversation(userID, conversationID)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	var message models.Message
+	if err := database.DB.
+		Scopes(visibleMessages(userID)).
+		Where("messages.id = ? AND messages.conversation_id = ?", messageID, conversationID).
+		First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Message{}, &actionError{http.StatusNotFound, "Message not found"}
+		}
+		return models.Message{}, err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Locking the conversation serializes concurrent pins, so the count
+		// cannot go stale before the insert
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			First(&models.Conversation{}, conversationID).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.PinnedMessage{}).Where("conversation_id = ?", conversationID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= maxPinsPerConversation {
+			return &actionError{http.StatusConflict, "Too many pinned messages in this conversation"}
+		}
+
+		pin := models.PinnedMessage{MessageID: message.ID, ConversationID: conversationID, PinnedByID: userID}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&pin)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &actionError{http.StatusConflict, "Message is already pinned"}
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	database.DB.Preload("Sender").Preload("Pin.PinnedBy").First(&message, message.ID)
+	message.Entities = loadEntities(message)
+
+	sendWithMaskedUser(hub, messageAudience(conversation, message.SenderID), message.Sender, func(sender models.User) map[string]interface{} {
+		event := message
+		event.Sender = sender
+		return map[string]interface{}{
+			"type":            "pin_added",
+			"conversation_id": conversationID,
+			"message":         event,
+		}
+	})
+
+	return message, nil
+}
+
+func unpinMessage(hub *Hub, userID, conversationID, messageID uint) error {
+	conversation, err := loadPinnableConversation(userID, conversationID)
+	if err != nil {
+		return err
+	}
+
+	var pin models.PinnedMessage
+	if err := database.DB.Where("message_id = ? AND conversation_id = ?", messageID, conversationID).First(&pin).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &actionError{http.StatusNotFound, "Message is not pinned"}
+		}
+		return err
+	}
+
+	if err := database.DB.Delete(&pin).Error; err != nil {
+		return err
+	}
+
+	var senderID uint
+	database.DB.Model(&models.Message{}).Where("id = ?", messageID).Pluck("sender_id", &senderID)
+
+	hub.SendToUsers(messageAudience(conversation, senderID), map[string]interface{}{
+		"type":            "pin_removed",
+		"conversation_id": conversationID,
+		"message_id":      messageID,
+		"unpinned_by":     userID,
+	})
+
+	return nil
+}
+
+// loadPinnableConversation checks that userID may change pins in the conversation.
+func loadPinnableConversation(userID, conversationID uint) (models.Conversation, error) {
+	var conversation models.Conversation
+	if err := database.DB.Preload("Participants").First(&conversation, conversationID).Error; err != nil {
+		return models.Conversation{}, &actionError{http.StatusNotFound, "Conversation not found"}
+	}
+
+	isParticipant := false
+	for _, participant := range conversation.Participants {
+		if participant.ID == userID {
+			isParticipant = true
+			break
+		}
+	}
+	if !isParticipant {
+		return models.Conversation{}, &actionError{http.StatusForbidden, "Access denied"}
+	}
+
+	// Groups have no roles yet; the creator acts as the admin
+	if conversation.Type == models.GroupChat && conversation.CreatedBy != userID {
+		return models.Conversation{}, &actionError{http.StatusForbidden, "Only the group admin can pin messages"}
+	}
+
+	return conversation, nil
+}
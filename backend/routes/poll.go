@@ -0,0 +1,459 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CreatePollInput struct {
+	Question       string     `json:"question" binding:"required,max=500"`
+	Options        []string   `json:"options" binding:"required,min=2,max=10,dive,max=200"`
+	MultipleChoice bool       `json:"multiple_choice"`
+	Anonymous      bool       `json:"anonymous"`
+	ClosesAt       *time.Time `json:"closes_at"`
+}
+
+type VotePollInput struct {
+	OptionIDs []uint `json:"option_ids" binding:"required,min=1,max=10"`
+}
+
+// CreatePoll posts a poll message to a conversation. The question doubles as
+// the message content, so previews and notifications read naturally.
+func CreatePoll(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var input CreatePollInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	question := strings.TrimSpace(input.Question)
+	if question == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Question is required"})
+		return
+	}
+
+	options := make([]models.PollOption, 0, len(input.Options))
+	seen := map[string]bool{}
+	for i, text := range input.Options {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Poll options cannot be empty"})
+			return
+		}
+		if seen[strings.ToLower(text)] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Poll options must be distinct"})
+			return
+		}
+		seen[strings.ToLower(text)] = true
+		options = append(options, models.PollOption{Position: i, Text: text})
+	}
+
+	if input.ClosesAt != nil && !input.ClosesAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "closes_at must be in the future"})
+		return
+	}
+
+	var conversation models.Conversation
+	if err := database.DB.Preload("Participants").First(&conversation, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+	if err := checkCanPost(user.ID, conversation); err != nil {
+		respondActionError(c, err, "Failed to create poll")
+		return
+	}
+
+	message := models.Message{
+		ConversationID: conversation.ID,
+		SenderID:       user.ID,
+		Content:        question,
+		Type:           models.PollMessage,
+		Status:         models.MessageSent,
+	}
+	poll := models.Poll{
+		ConversationID: conversation.ID,
+		Question:       question,
+		MultipleChoice: input.MultipleChoice,
+		Anonymous:      input.Anonymous,
+		ClosesAt:       input.ClosesAt,
+		Options:        options,
+	}
+
+	var mentions []models.MessageMention
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		mentions, err = saveMessage(hub, tx, &message, conversation)
+		if err != nil {
+			return err
+		}
+		poll.MessageID = message.ID
+		return tx.Create(&poll).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create poll"})
+		return
+	}
+
+	attachPollResults([]*models.Poll{&poll}, user.ID)
+	message.Sender = user
+	message.Poll = &poll
+	message.Entities = messageEntities(message, mentions)
+
+	deliverMessage(hub, conversation, message, mentions)
+	clearDraftAfterSend(hub, message)
+
+	c.JSON(http.StatusCreated, gin.H{"message": message})
+}
+
+// GetPoll returns a poll with its current tallies.
+func GetPoll(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	pollID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID"})
+		return
+	}
+
+	poll, _, _, err := loadPoll(database.DB, user.ID, uint(pollID), false)
+	if err != nil {
+		respondActionError(c, err, "Failed to fetch poll")
+		return
+	}
+	attachPollResults([]*models.Poll{&poll}, user.ID)
+
+	c.JSON(http.StatusOK, gin.H{"poll": poll})
+}
+
+// VotePoll replaces the current user's votes with option_ids. Single-choice
+// polls take exactly one option, so voting again changes the vote.
+func VotePoll(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	pollID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID"})
+		return
+	}
+
+	var input VotePollInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	poll, err := castVote(hub, user.ID, uint(pollID), input.OptionIDs)
+	if err != nil {
+		respondActionError(c, err, "Failed to vote")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"poll": poll})
+}
+
+// RetractPollVote removes the current user's vote for ?option_id=, or all of
+// their votes when no option is given.
+func RetractPollVote(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	pollID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID"})
+		return
+	}
+
+	var optionID uint64
+	if value := c.Query("option_id"); value != "" {
+		if optionID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid option ID"})
+			return
+		}
+	}
+
+	poll, err := retractVote(hub, user.ID, uint(pollID), uint(optionID))
+	if err != nil {
+		respondActionError(c, err, "Failed to retract vote")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"poll": poll})
+}
+
+// ClosePoll ends voting early. Only the poll's creator may close it.
+func ClosePoll(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	pollID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID"})
+		return
+	}
+
+	var poll models.Poll
+	var message models.Message
+	var conversation models.Conversation
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		poll, message, conversation, err = loadPoll(tx, user.ID, uint(pollID), true)
+		if err != nil {
+			return err
+		}
+		if message.SenderID != user.ID {
+			return &actionError{http.StatusForbidden, "Only the poll's creator can close it"}
+		}
+		if poll.IsClosed(time.Now()) {
+			return &actionError{http.StatusConflict, "Poll is already closed"}
+		}
+
+		now := time.Now()
+		poll.ClosedAt = &now
+		return tx.Model(&models.Poll{}).Where("id = ?", poll.ID).Update("closed_at", now).Error
+	})
+	if err != nil {
+		respondActionError(c, err, "Failed to close poll")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"poll": publishPoll(hub, poll, message, conversation, user.ID)})
+}
+
+func castVote(hub *Hub, userID, pollID uint, optionIDs []uint) (models.Poll, error) {
+	var poll models.Poll
+	var message models.Message
+	var conversation models.Conversation
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		poll, message, conversation, err = loadPoll(tx, userID, pollID, true)
+		if err != nil {
+			return err
+		}
+		if poll.IsClosed(time.Now()) {
+			return &actionError{http.StatusConflict, "Poll is closed"}
+		}
+
+		chosen := idSet(optionIDs)
+		if !poll.MultipleChoice && len(chosen) != 1 {
+			return &actionError{http.StatusBadRequest, "This poll allows only one choice"}
+		}
+		valid := map[uint]bool{}
+		for _, option := range poll.Options {
+			valid[option.ID] = true
+		}
+		for optionID := range chosen {
+			if !valid[optionID] {
+				return &actionError{http.StatusBadRequest, "Unknown poll option"}
+			}
+		}
+
+		if err := tx.Where("poll_id = ? AND user_id = ?", poll.ID, userID).Delete(&models.PollVote{}).Error; err != nil {
+			return err
+		}
+		votes := make([]models.PollVote, 0, len(chosen))
+		for optionID := range chosen {
+			votes = append(votes, models.PollVote{OptionID: optionID, UserID: userID, PollID: poll.ID})
+		}
+		return tx.Create(&votes).Error
+	})
+	if err != nil {
+		return models.Poll{}, err
+	}
+
+	return publishPoll(hub, poll, message, conversation, userID), nil
+}
+
+// retractVote removes userID's vote for optionID, or all their votes when
+// optionID is 0.
+func retractVote(hub *Hub, userID, pollID, optionID uint) (models.Poll, error) {
+	var poll models.Poll
+	var message models.Message
+	var conversation models.Conversation
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		poll, message, conversation, err = loadPoll(tx, userID, pollID, true)
+		if err != nil {
+			return err
+		}
+		if poll.IsClosed(time.Now()) {
+			return &actionError{http.StatusConflict, "Poll is closed"}
+		}
+
+		query := tx.Where("poll_id = ? AND user_id = ?", poll.ID, userID)
+		if optionID != 0 {
+			query = query.Where("option_id = ?", optionID)
+		}
+		return query.Delete(&models.PollVote{}).Error
+	})
+	if err != nil {
+		return models.Poll{}, err
+	}
+
+	return publishPoll(hub, poll, message, conversation, userID), nil
+}
+
+// loadPoll loads a poll with its options and checks that userID can see it.
+// With lock set, the poll row stays locked until tx ends so concurrent votes
+// from the same user cannot interleave.
+func loadPoll(tx *gorm.DB, userID, pollID uint, lock bool) (models.Poll, models.Message, models.Conversation, error) {
+	var poll models.Poll
+	var message models.Message
+	var conversation models.Conversation
+	notFound := &actionError{http.StatusNotFound, "Poll not found"}
+
+	query := tx
+	if lock {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	if err := query.First(&poll, pollID).Error; err != nil {
+		return poll, message, conversation, notFound
+	}
+	if err := tx.Where("poll_id = ?", poll.ID).Order("position").Find(&poll.Options).Error; err != nil {
+		return poll, message, conversation, err
+	}
+
+	if err := tx.Scopes(unexpiredMessages).First(&message, poll.MessageID).Error; err != nil {
+		return poll, message, conversation, notFound
+	}
+	if err := tx.Preload("Participants").First(&conversation, poll.ConversationID).Error; err != nil {
+		return poll, message, conversation, notFound
+	}
+
+	isParticipant := false
+	for _, participant := range conversation.Participants {
+		if participant.ID == userID {
+			isParticipant = true
+			break
+		}
+	}
+	// Polls from users the viewer blocked are hidden along with their messages
+	if !isParticipant || blockerIDsOf(message.SenderID)[userID] {
+		return poll, message, conversation, notFound
+	}
+
+	return poll, message, conversation, nil
+}
+
+// publishPoll fills in the tallies and sends poll_updated to everyone who can
+// see the poll. The actor's own clients also get their my_votes.
+func publishPoll(hub *Hub, poll models.Poll, message models.Message, conversation models.Conversation, actorID uint) models.Poll {
+	attachPollResults([]*models.Poll{&poll}, actorID)
+
+	shared := poll
+	shared.MyVotes = nil
+
+	var others []uint
+	for _, id := range messageAudience(conversation, message.SenderID) {
+		if id != actorID {
+			others = append(others, id)
+		}
+	}
+
+	hub.SendToUsers(others, map[string]interface{}{
+		"type":            "poll_updated",
+		"conversation_id": conversation.ID,
+		"poll":            shared,
+	})
+	hub.SendToUsers([]uint{actorID}, map[string]interface{}{
+		"type":            "poll_updated",
+		"conversation_id": conversation.ID,
+		"poll":            poll,
+	})
+
+	return poll
+}
+
+// attachPolls loads the polls of poll messages with tallies for viewerID.
+func attachPolls(messages []models.Message, viewerID uint) {
+	var ids []uint
+	for i := range messages {
+		if messages[i].Type == models.PollMessage {
+			ids = append(ids, messages[i].ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	var polls []models.Poll
+	database.DB.Where("message_id IN ?", ids).
+		Preload("Options", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Find(&polls)
+
+	byMessage := make(map[uint]*models.Poll, len(polls))
+	pointers := make([]*models.Poll, len(polls))
+	for i := range polls {
+		byMessage[polls[i].MessageID] = &polls[i]
+		pointers[i] = &polls[i]
+	}
+	attachPollResults(pointers, viewerID)
+
+	for i := range messages {
+		if poll, ok := byMessage[messages[i].ID]; ok {
+			messages[i].Poll = poll
+		}
+	}
+}
+
+// attachPollResults fills in vote counts, voters (unless anonymous) and the
+// options viewerID voted for.
+func attachPollResults(polls []*models.Poll, viewerID uint) {
+	if len(polls) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(polls))
+	for i, poll := range polls {
+		ids[i] = poll.ID
+	}
+
+	var votes []models.PollVote
+	database.DB.Where("poll_id IN ?", ids).Order("created_at, user_id").Find(&votes)
+
+	byPoll := map[uint][]models.PollVote{}
+	for _, vote := range votes {
+		byPoll[vote.PollID] = append(byPoll[vote.PollID], vote)
+	}
+
+	now := time.Now()
+	for _, poll := range polls {
+		counts := map[uint]int{}
+		voters := map[uint][]uint{}
+		distinct := map[uint]bool{}
+		poll.MyVotes = nil
+
+		for _, vote := range byPoll[poll.ID] {
+			counts[vote.OptionID]++
+			distinct[vote.UserID] = true
+			if !poll.Anonymous {
+				voters[vote.OptionID] = append(voters[vote.OptionID], vote.UserID)
+			}
+			if vote.UserID == viewerID {
+				poll.MyVotes = append(poll.MyVotes, vote.OptionID)
+			}
+		}
+
+		poll.Closed = poll.IsClosed(now)
+		poll.TotalVoters = len(distinct)
+		for i := range poll.Options {
+			poll.Options[i].VoteCount = counts[poll.Options[i].ID]
+			poll.Options[i].Voters = voters[poll.Options[i].ID]
+		}
+	}
+}
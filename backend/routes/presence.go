@@ -0,0 +1,328 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UpdatePrivacyInput struct {
+	StatusVisibility   *models.PresenceVisibility `json:"status_visibility" binding:"omitempty,oneof=everyone contacts nobody"`
+	LastSeenVisibility *models.PresenceVisibility `json:"last_seen_visibility" binding:"omitempty,oneof=everyone contacts nobody"`
+}
+
+// UpdatePrivacy changes who can see the current user's status and last seen
+// time. Users who gain or lose visibility are sent a fresh status_change.
+func UpdatePrivacy(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var input UpdatePrivacyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before := presenceAudience(user)
+
+	updates := map[string]interface{}{}
+	if input.StatusVisibility != nil {
+		updates["status_visibility"] = *input.StatusVisibility
+		user.StatusVisibility = *input.StatusVisibility
+	}
+	if input.LastSeenVisibility != nil {
+		updates["last_seen_visibility"] = *input.LastSeenVisibility
+		user.LastSeenVisibility = *input.LastSeenVisibility
+	}
+
+	if len(updates) > 0 {
+		if err := database.DB.Model(&user).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update privacy settings"})
+			return
+		}
+
+		// Reload the status: the copy from the auth middleware may be stale
+		// if the WebSocket connected or dropped since the request started
+		var fresh models.User
+		database.DB.First(&fresh, user.ID)
+
+		after := presenceAudience(user)
+		var gained, lost []uint
+		for id := range after {
+			if !before[id] {
+				gained = append(gained, id)
+			}
+		}
+		for id := range before {
+			if !after[id] {
+				lost = append(lost, id)
+			}
+		}
+
+		if len(gained) > 0 && fresh.Status != "offline" {
+			hub.SendToUsers(gained, statusChangeEvent(fresh))
+		}
+		if len(lost) > 0 {
+			hub.SendToUsers(lost, statusChangeEvent(models.User{ID: user.ID, Status: "offline"}))
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status_visibility":    user.StatusVisibility,
+		"last_seen_visibility": user.LastSeenVisibility,
+	})
+}
+
+type UpdateStatusInput struct {
+	Presence          *models.PresenceStatus `json:"presence"`
+	CustomStatusText  *string                `json:"custom_status_text"`
+	CustomStatusEmoji *string                `json:"custom_status_emoji"`
+	ExpiresAt         *time.Time             `json:"custom_status_expires_at"`
+	ClearCustomStatus bool                   `json:"clear_custom_status"`
+}
+
+// UpdateStatus sets the current user's presence and custom status. The same
+// update can be sent over the WebSocket as a set_status frame.
+func UpdateStatus(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var input UpdateStatusInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := applyStatusUpdate(user.ID, input)
+	if err != nil {
+		if errors.Is(err, errInvalidStatus) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update status"})
+		}
+		return
+	}
+
+	hub.RefreshPresence(user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"presence":                 updated.Presence,
+		"custom_status_text":       updated.CustomStatusText,
+		"custom_status_emoji":      updated.CustomStatusEmoji,
+		"custom_status_expires_at": updated.CustomStatusExpiresAt,
+	})
+}
+
+var errInvalidStatus = errors.New("invalid status")
+
+// applyStatusUpdate validates and stores a presence or custom status change.
+// Setting either custom status field replaces the whole custom status.
+func applyStatusUpdate(userID uint, input UpdateStatusInput) (models.User, error) {
+	updates := map[string]interface{}{}
+
+	if input.Presence != nil {
+		if !models.ValidPresence[*input.Presence] {
+			return models.User{}, fmt.Errorf("%w: presence must be online, away, dnd or invisible", errInvalidStatus)
+		}
+		updates["presence"] = *input.Presence
+	}
+
+	switch {
+	case input.ClearCustomStatus:
+		updates["custom_status_text"] = ""
+		updates["custom_status_emoji"] = ""
+		updates["custom_status_expires_at"] = nil
+	case input.CustomStatusText != nil || input.CustomStatusEmoji != nil:
+		var text, emoji string
+		if input.CustomStatusText != nil {
+			text = strings.TrimSpace(*input.CustomStatusText)
+		}
+		if input.CustomStatusEmoji != nil {
+			emoji = strings.TrimSpace(*input.CustomStatusEmoji)
+		}
+		if utf8.RuneCountInString(text) > 100 {
+			return models.User{}, fmt.Errorf("%w: custom status text is limited to 100 characters", errInvalidStatus)
+		}
+		if utf8.RuneCountInString(emoji) > 16 {
+			return models.User{}, fmt.Errorf("%w: custom status emoji is too long", errInvalidStatus)
+		}
+		if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+			return models.User{}, fmt.Errorf("%w: custom status expiry must be in the future", errInvalidStatus)
+		}
+		updates["custom_status_text"] = text
+		updates["custom_status_emoji"] = emoji
+		updates["custom_status_expires_at"] = input.ExpiresAt
+	}
+
+	if len(updates) > 0 {
+		if err := database.DB.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+			return models.User{}, err
+		}
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// presenceAudience returns the users who receive live status changes for
+// user: conversation peers and contacts, narrowed by the user's
+// status_visibility and excluding anyone the user has blocked.
+func presenceAudience(user models.User) map[uint]bool {
+	audience := map[uint]bool{}
+
+	switch user.StatusVisibility {
+	case models.VisibilityNobody:
+		return audience
+	case models.VisibilityContacts:
+		audience = contactIDsOf(user.ID)
+	default:
+		audience = contactIDsOf(user.ID)
+		for _, id := range conversationPeerIDs(user.ID) {
+			audience[id] = true
+		}
+	}
+
+	delete(audience, user.ID)
+	for id := range blockedUserIDs(user.ID) {
+		delete(audience, id)
+	}
+
+	return audience
+}
+
+// statusChangeEvent describes user's current status and custom status.
+func statusChangeEvent(user models.User) map[string]interface{} {
+	event := map[string]interface{}{
+		"type":    "status_change",
+		"user_id": user.ID,
+		"status":  user.Status,
+	}
+	if user.CustomStatusActive(time.Now()) {
+		event["custom_status"] = map[string]interface{}{
+			"text":       user.CustomStatusText,
+			"emoji":      user.CustomStatusEmoji,
+			"expires_at": user.CustomStatusExpiresAt,
+		}
+	}
+	return event
+}
+
+// maskPresence hides status, custom status and last seen time from viewerID
+// according to each user's privacy settings. Users who have blocked the
+// viewer always appear offline.
+func maskPresence(users []models.User, viewerID uint) {
+	blockers := blockerIDsOf(viewerID)
+
+	var contacts map[uint]bool
+	isContact := func(id uint) bool {
+		if contacts == nil {
+			contacts = contactIDsOf(viewerID)
+		}
+		return contacts[id]
+	}
+
+	now := time.Now()
+	for i := range users {
+		user := &users[i]
+		if !user.CustomStatusActive(now) {
+			user.ClearCustomStatus()
+		}
+		if user.ID == viewerID {
+			continue
+		}
+
+		// Only the owner sees their chosen presence, e.g. invisible
+		user.Presence = ""
+
+		if blockers[user.ID] || !presenceVisible(user.StatusVisibility, user.ID, isContact) {
+			user.Status = "offline"
+			user.ClearCustomStatus()
+		}
+		if blockers[user.ID] || !presenceVisible(user.LastSeenVisibility, user.ID, isContact) {
+			user.LastSeen = time.Time{}
+		}
+	}
+}
+
+func presenceVisible(visibility models.PresenceVisibility, ownerID uint, isContact func(uint) bool) bool {
+	switch visibility {
+	case models.VisibilityNobody:
+		return false
+	case models.VisibilityContacts:
+		return isContact(ownerID)
+	}
+	return true
+}
+
+// sendWithMaskedUser sends an event showing user to each recipient as
+// maskPresence would show them to that viewer. Recipients are grouped by what
+// they may see, so a message to a large group costs two lookups and at most
+// five encodings rather than a mask per recipient.
+func sendWithMaskedUser(hub *Hub, recipients []uint, user models.User, event func(models.User) map[string]interface{}) {
+	if !user.CustomStatusActive(time.Now()) {
+		user.ClearCustomStatus()
+	}
+
+	blocked := blockedUserIDs(user.ID)
+	var contacts map[uint]bool
+	type visibility struct{ status, lastSeen bool }
+	groups := map[visibility][]uint{}
+	var self []uint
+
+	for _, id := range recipients {
+		if id == user.ID {
+			self = append(self, id)
+			continue
+		}
+		isContact := func(uint) bool {
+			if contacts == nil {
+				contacts = contactIDsOf(user.ID)
+			}
+			return contacts[id]
+		}
+		key := visibility{
+			status:   !blocked[id] && presenceVisible(user.StatusVisibility, user.ID, isContact),
+			lastSeen: !blocked[id] && presenceVisible(user.LastSeenVisibility, user.ID, isContact),
+		}
+		groups[key] = append(groups[key], id)
+	}
+
+	if len(self) > 0 {
+		hub.SendToUsers(self, event(user))
+	}
+	for key, ids := range groups {
+		masked := user
+		masked.Presence = ""
+		if !key.status {
+			masked.Status = "offline"
+			masked.ClearCustomStatus()
+		}
+		if !key.lastSeen {
+			masked.LastSeen = time.Time{}
+		}
+		hub.SendToUsers(ids, event(masked))
+	}
+}
+
+// maskSenderPresence applies maskPresence to the senders of messages.
+func maskSenderPresence(messages []models.Message, viewerID uint) {
+	senders := make([]models.User, len(messages))
+	for i := range messages {
+		senders[i] = messages[i].Sender
+	}
+	maskPresence(senders, viewerID)
+	for i := range messages {
+		messages[i].Sender = senders[i]
+	}
+}
@@ -0,0 +1,106 @@
+package routes
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+)
+
+// drainEvents collects what the hub was asked to send, keyed by recipient.
+func drainEvents(t *testing.T, hub *Hub) map[uint]map[string]interface{} {
+	t.Helper()
+
+	events := map[uint]map[string]interface{}{}
+	for {
+		select {
+		case message := <-hub.targeted:
+			var event map[string]interface{}
+			if err := json.Unmarshal(message.payload, &event); err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range message.userIDs {
+				events[id] = event
+			}
+		default:
+			return events
+		}
+	}
+}
+
+func TestDeliverMessageMasksSenderPresencePerRecipient(t *testing.T) {
+	useTestDB(t)
+
+	sender := createTestUser(t, "masked_sender")
+	contact := createTestUser(t, "masked_contact")
+	stranger := createTestUser(t, "masked_stranger")
+	blocked := createTestUser(t, "masked_blocked")
+
+	database.DB.Create(&[]models.Contact{
+		{UserID: sender.ID, ContactID: contact.ID},
+		{UserID: contact.ID, ContactID: sender.ID},
+	})
+	database.DB.Create(&models.UserBlock{BlockerID: sender.ID, BlockedID: blocked.ID})
+
+	sender.Status = "online"
+	sender.Presence = models.PresenceOnline
+	sender.LastSeen = time.Now()
+	sender.StatusVisibility = models.VisibilityContacts
+	sender.LastSeenVisibility = models.VisibilityEveryone
+
+	conversation := models.Conversation{Participants: []models.User{sender, contact, stranger, blocked}}
+	message := models.Message{SenderID: sender.ID, Sender: sender, Content: "hi"}
+
+	hub := NewHub()
+	deliverMessage(hub, conversation, message, nil)
+	events := drainEvents(t, hub)
+
+	senderOf := func(id uint) map[string]interface{} {
+		event, ok := events[id]
+		if !ok {
+			t.Fatalf("user %d got no event", id)
+		}
+		return event["message"].(map[string]interface{})["sender"].(map[string]interface{})
+	}
+
+	if got := senderOf(sender.ID); got["presence"] != "online" {
+		t.Errorf("sender's own clients got presence %v, want online", got["presence"])
+	}
+	if got := senderOf(contact.ID); got["status"] != "online" || got["presence"] != nil {
+		t.Errorf("contact sees status %v presence %v, want online and no presence", got["status"], got["presence"])
+	}
+	if got := senderOf(stranger.ID); got["status"] != "offline" || got["last_seen"] == "0001-01-01T00:00:00Z" {
+		t.Errorf("stranger sees status %v last seen %v, want offline with last seen", got["status"], got["last_seen"])
+	}
+	if got := senderOf(blocked.ID); got["status"] != "offline" || got["last_seen"] != "0001-01-01T00:00:00Z" {
+		t.Errorf("blocked user sees status %v last seen %v, want neither", got["status"], got["last_seen"])
+	}
+}
+
+func TestConnectionStateIsIdleOnlyWhenEveryConnectionIs(t *testing.T) {
+	tests := []struct {
+		name          string
+		idle          []bool // one entry per connection
+		wantConnected bool
+		wantIdle      bool
+	}{
+		{"no connections", nil, false, false},
+		{"one active", []bool{false}, true, false},
+		{"one idle", []bool{true}, true, true},
+		{"idle and active devices", []bool{true, false}, true, false},
+		{"all devices idle", []bool{true, true}, true, true},
+	}
+
+	for _, tt := range tests {
+		clients := map[*Client]bool{}
+		for _, idle := range tt.idle {
+			clients[&Client{idle: idle}] = true
+		}
+		connected, idle := connectionState(clients)
+		if connected != tt.wantConnected || idle != tt.wantIdle {
+			t.Errorf("%s: connectionState = (%v, %v), want (%v, %v)", tt.name, connected, idle, tt.wantConnected, tt.wantIdle)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MarkReadInput struct {
+	MessageID uint `json:"message_id"` // 0 marks everything read
+}
+
+type MuteConversationInput struct {
+	Muted      bool       `json:"muted"`
+	MutedUntil *time.Time `json:"muted_until"` // Omit to mute indefinitely
+}
+
+// MarkConversationRead moves the current user's read marker forward. It never
+// moves backwards, so out-of-order requests are harmless.
+func MarkConversationRead(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	conversationID, ok := participantConversationID(c, user.ID)
+	if !ok {
+		return
+	}
+
+	var input MarkReadInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	messageID := input.MessageID
+	if messageID == 0 {
+		database.DB.Model(&models.Message{}).
+			Where("conversation_id = ?", conversationID).
+			Select("COALESCE(MAX(id), 0)").
+			Scan(&messageID)
+	} else {
+		var count int64
+		database.DB.Model(&models.Message{}).
+			Where("id = ? AND conversation_id = ?", messageID, conversationID).
+			Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+			return
+		}
+	}
+
+	state := models.ConversationReadState{
+		UserID:            user.ID,
+		ConversationID:    conversationID,
+		LastReadMessageID: messageID,
+	}
+	if err := database.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "conversation_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"last_read_message_id": gorm.Expr("GREATEST(conversation_read_states.last_read_message_id, EXCLUDED.last_read_message_id)"),
+			"updated_at":           time.Now(),
+		}),
+	}).Create(&state).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update read state"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"last_read_message_id": messageID})
+}
+
+// MuteConversation mutes or unmutes a conversation for the current user.
+// Mentions still notify in muted conversations.
+func MuteConversation(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	conversationID, ok := participantConversationID(c, user.ID)
+	if !ok {
+		return
+	}
+
+	var input MuteConversationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !input.Muted {
+		input.MutedUntil = nil
+	} else if input.MutedUntil != nil && !input.MutedUntil.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "muted_until must be in the future"})
+		return
+	}
+
+	state := models.ConversationReadState{
+		UserID:         user.ID,
+		ConversationID: conversationID,
+		Muted:          input.Muted,
+		MutedUntil:     input.MutedUntil,
+	}
+	if err := database.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "conversation_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"muted":       input.Muted,
+			"muted_until": input.MutedUntil,
+			"updated_at":  time.Now(),
+		}),
+	}).Create(&state).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update mute setting"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"muted": input.Muted, "muted_until": input.MutedUntil})
+}
+
+// participantConversationID parses :id and checks that userID takes part in it.
+func participantConversationID(c *gin.Context, userID uint) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		return 0, false
+	}
+
+	var count int64
+	database.DB.Table("conversation_participants").
+		Where("conversation_id = ? AND user_id = ?", id, userID).
+		Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+// applyReadStates fills in unread counts and mute state for userID. Messages
+// from the user and from users they blocked do not count as unread.
+func applyReadStates(conversations []models.Conversation, userID uint) {
+	if len(conversations) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(conversations))
+	for i := range conversations {
+		ids[i] = conversations[i].ID
+	}
+
+	var counts []struct {
+		ConversationID uint
+		Unread         int64
+		Mentions       int64
+	}
+	database.DB.Table("messages").
+		Select("messages.conversation_id, COUNT(*) AS unread, "+
+			"COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM message_mentions mm WHERE mm.message_id = messages.id AND mm.user_id = ?)) AS mentions", userID).
+		Joins("LEFT JOIN conversation_read_states rs ON rs.conversation_id = messages.conversation_id AND rs.user_id = ?", userID).
+		Where("messages.conversation_id IN ?", ids).
+		Where("messages.deleted_at IS NULL").
+		Where("messages.sender_id <> ?", userID).
+		Where("messages.sender_id NOT IN (?)", blockedSenderSubquery(userID)).
+		Where("messages.id > COALESCE(rs.last_read_message_id, 0)").
+		Scopes(unexpiredMessages).
+		Group("messages.conversation_id").
+		Scan(&counts)
+
+	var states []models.ConversationReadState
+	database.DB.Where("user_id = ? AND conversation_id IN ?", userID, ids).Find(&states)
+
+	byID := make(map[uint]*models.Conversation, len(conversations))
+	for i := range conversations {
+		byID[conversations[i].ID] = &conversations[i]
+	}
+	for _, count := range counts {
+		byID[count.ConversationID].UnreadCount = count.Unread
+		byID[count.ConversationID].UnreadMentionCount = count.Mentions
+	}
+	now := time.Now()
+	for i := range states {
+		byID[states[i].ConversationID].Muted = states[i].IsMuted(now)
+	}
+}
@@ -0,0 +1,391 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	_ "time/tzdata" // Time zones must resolve even on hosts without zoneinfo
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxScheduleAhead           = 365 * 24 * time.Hour
+	maxPendingScheduledPerUser = 100
+	scheduledBatchSize         = 50
+)
+
+type CreateScheduledMessageInput struct {
+	ConversationID uint   `json:"conversation_id" binding:"required"`
+	Content        string `json:"content" binding:"max=10000"`
+	MessageType    string `json:"message_type" binding:"omitempty,oneof=text image video audio file"`
+	Format         string `json:"format" binding:"omitempty,oneof=plain markdown"`
+	MediaURL       string `json:"media_url" binding:"max=1000"`
+	ReplyToID      *uint  `json:"reply_to_id"`
+	SendAt         string `json:"send_at" binding:"required"`
+	TimeZone       string `json:"time_zone"`
+}
+
+type UpdateScheduledMessageInput struct {
+	Content  *string `json:"content" binding:"omitempty,max=10000"`
+	SendAt   *string `json:"send_at"`
+	TimeZone *string `json:"time_zone"`
+}
+
+// CreateScheduledMessage schedules a message. send_at is either RFC 3339 with
+// an offset, or a local wall-clock time ("2026-01-05T09:00:00") interpreted
+// in time_zone, e.g. "Asia/Tokyo".
+func CreateScheduledMessage(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var input CreateScheduledMessageInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if strings.TrimSpace(input.Content) == "" && input.MediaURL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message content is required"})
+		return
+	}
+
+	format := models.FormatPlain
+	if input.Format != "" {
+		format = models.MessageFormat(input.Format)
+	}
+	// Check markdown now rather than failing when the message falls due
+	if format == models.FormatMarkdown {
+		if _, _, err := renderMarkup(input.Content); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	sendAt, err := parseSendAt(input.SendAt, input.TimeZone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var conversation models.Conversation
+	if err := database.DB.Preload("Participants").First(&conversation, input.ConversationID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+	if err := checkCanPost(user.ID, conversation); err != nil {
+		respondActionError(c, err, "Failed to schedule message")
+		return
+	}
+
+	if input.ReplyToID != nil {
+		var count int64
+		database.DB.Model(&models.Message{}).
+			Scopes(visibleMessages(user.ID)).
+			Where("messages.id = ? AND messages.conversation_id = ?", *input.ReplyToID, conversation.ID).
+			Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Reply target not found"})
+			return
+		}
+	}
+
+	var pending int64
+	database.DB.Model(&models.ScheduledMessage{}).Where("sender_id = ? AND status = ?", user.ID, models.ScheduledPending).Count(&pending)
+	if pending >= maxPendingScheduledPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": "Too many scheduled messages"})
+		return
+	}
+
+	msgType := models.TextMessage
+	if input.MessageType != "" {
+		msgType = models.MessageType(input.MessageType)
+	}
+
+	scheduled := models.ScheduledMessage{
+		ConversationID: conversation.ID,
+		SenderID:       user.ID,
+		Content:        input.Content,
+		Type:           msgType,
+		Format:         format,
+		MediaURL:       input.MediaURL,
+		ReplyToID:      input.ReplyToID,
+		SendAt:         sendAt,
+		TimeZone:       input.TimeZone,
+		Status:         models.ScheduledPending,
+	}
+	if err := database.DB.Create(&scheduled).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule message"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"scheduled_message": scheduled})
+}
+
+// GetScheduledMessages lists the current user's pending scheduled messages,
+// optionally for one conversation (?conversation_id=).
+func GetScheduledMessages(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	query := database.DB.Where("sender_id = ? AND status = ?", user.ID, models.ScheduledPending)
+	if conversationID := c.Query("conversation_id"); conversationID != "" {
+		query = query.Where("conversation_id = ?", conversationID)
+	}
+
+	var scheduled []models.ScheduledMessage
+	if err := query.Order("send_at ASC").Find(&scheduled).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scheduled messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"scheduled_messages": scheduled})
+}
+
+// UpdateScheduledMessage edits the content or send time of a pending message.
+func UpdateScheduledMessage(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var input UpdateScheduledMessageInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var scheduled models.ScheduledMessage
+	if err := database.DB.Where("id = ? AND sender_id = ?", c.Param("id"), user.ID).First(&scheduled).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled message not found"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.Content != nil {
+		if strings.TrimSpace(*input.Content) == "" && scheduled.MediaURL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Message content is required"})
+			return
+		}
+		if scheduled.Format == models.FormatMarkdown {
+			if _, _, err := renderMarkup(*input.Content); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		updates["content"] = *input.Content
+	}
+	if input.SendAt != nil || input.TimeZone != nil {
+		sendAtText := scheduled.SendAt.Format(time.RFC3339)
+		if input.SendAt != nil {
+			sendAtText = *input.SendAt
+		}
+		timeZone := scheduled.TimeZone
+		if input.TimeZone != nil {
+			timeZone = *input.TimeZone
+		}
+
+		sendAt, err := parseSendAt(sendAtText, timeZone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["send_at"] = sendAt
+		updates["time_zone"] = timeZone
+	}
+
+	if len(updates) > 0 {
+		// The status condition loses the race cleanly if the scheduler
+		// claimed the row in the meantime
+		result := database.DB.Model(&models.ScheduledMessage{}).
+			Where("id = ? AND status = ?", scheduled.ID, models.ScheduledPending).
+			Updates(updates)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scheduled message"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Scheduled message was already sent or cancelled"})
+			return
+		}
+	}
+
+	database.DB.First(&scheduled, scheduled.ID)
+	c.JSON(http.StatusOK, gin.H{"scheduled_message": scheduled})
+}
+
+// CancelScheduledMessage cancels a pending scheduled message.
+func CancelScheduledMessage(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	result := database.DB.Model(&models.ScheduledMessage{}).
+		Where("id = ? AND sender_id = ? AND status = ?", c.Param("id"), user.ID, models.ScheduledPending).
+		Update("status", models.ScheduledCancelled)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel scheduled message"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled message not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Scheduled message cancelled"})
+}
+
+// parseSendAt reads an RFC 3339 time, or a wall-clock time in timeZone, and
+// checks that it is in the future but not too far ahead.
+func parseSendAt(value, timeZone string) (time.Time, error) {
+	var sendAt time.Time
+	var err error
+
+	if timeZone != "" {
+		location, locErr := time.LoadLocation(timeZone)
+		if locErr != nil || timeZone == "Local" {
+			return time.Time{}, fmt.Errorf("unknown time zone %q", timeZone)
+		}
+		sendAt, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			sendAt, err = time.ParseInLocation("2006-01-02T15:04:05", value, location)
+		}
+		if err != nil {
+			sendAt, err = time.ParseInLocation("2006-01-02T15:04", value, location)
+		}
+	} else {
+		sendAt, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		return time.Time{}, errors.New("send_at must be RFC 3339, or a local time such as 2026-01-05T09:00:00 with time_zone")
+	}
+
+	now := time.Now()
+	if !sendAt.After(now) {
+		return time.Time{}, errors.New("send_at must be in the future")
+	}
+	if sendAt.After(now.Add(maxScheduleAhead)) {
+		return time.Time{}, errors.New("send_at must be within a year")
+	}
+
+	return sendAt.UTC(), nil
+}
+
+// RunMessageScheduler sends scheduled messages when they fall due. Rows are
+// claimed with FOR UPDATE SKIP LOCKED and the message is created in the same
+// transaction that marks the row sent, so several replicas can run the
+// scheduler side by side and a crash mid-batch simply retries after restart.
+func RunMessageScheduler(hub *Hub) {
+	ticker := time.NewTicker(envDuration("SCHEDULED_MESSAGES_INTERVAL", 10*time.Second))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// Keep going while full batches come back, so a backlog drains quickly
+		for dispatchScheduledMessages(hub) == scheduledBatchSize {
+		}
+	}
+}
+
+// scheduledDelivery is a message created by the scheduler, delivered once
+// its transaction has committed.
+type scheduledDelivery struct {
+	conversation models.Conversation
+	message      models.Message
+	mentions     []models.MessageMention
+}
+
+func dispatchScheduledMessages(hub *Hub) int {
+	var deliveries []scheduledDelivery
+	claimed := 0
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var due []models.ScheduledMessage
+		if err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND send_at <= ?", models.ScheduledPending, time.Now()).
+			Order("send_at ASC").
+			Limit(scheduledBatchSize).
+			Find(&due).Error; err != nil {
+			return err
+		}
+		claimed = len(due)
+
+		for _, scheduled := range due {
+			delivery, err := sendScheduledMessage(hub, tx, scheduled)
+			if err != nil {
+				log.Printf("Scheduled message %d failed: %v", scheduled.ID, err)
+				if err := tx.Model(&scheduled).Updates(map[string]interface{}{
+					"status":         models.ScheduledFailed,
+					"failure_reason": err.Error(),
+				}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			deliveries = append(deliveries, delivery)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error dispatching scheduled messages: %v", err)
+		return 0
+	}
+
+	for _, delivery := range deliveries {
+		message := delivery.message
+		database.DB.Preload("Sender").First(&message, message.ID)
+		message.Entities = messageEntities(message, delivery.mentions)
+		deliverMessage(hub, delivery.conversation, message, delivery.mentions)
+		unfurlLater(hub, delivery.conversation, message)
+	}
+
+	return claimed
+}
+
+// sendScheduledMessage turns one claimed row into a real message inside a
+// savepoint, so a failure only affects that row.
+func sendScheduledMessage(hub *Hub, tx *gorm.DB, scheduled models.ScheduledMessage) (scheduledDelivery, error) {
+	var delivery scheduledDelivery
+
+	// Membership and blocks may have changed since the message was scheduled
+	if err := tx.Preload("Participants").First(&delivery.conversation, scheduled.ConversationID).Error; err != nil {
+		return delivery, errors.New("conversation not found")
+	}
+	if err := checkCanPost(scheduled.SenderID, delivery.conversation); err != nil {
+		return delivery, err
+	}
+
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		delivery.message = models.Message{
+			ConversationID: scheduled.ConversationID,
+			SenderID:       scheduled.SenderID,
+			Content:        scheduled.Content,
+			Type:           scheduled.Type,
+			Status:         models.MessageSent,
+			MediaURL:       scheduled.MediaURL,
+			ReplyToID:      scheduled.ReplyToID,
+			Format:         scheduled.Format,
+		}
+		if err := applyMarkup(&delivery.message); err != nil {
+			return err
+		}
+
+		var err error
+		delivery.mentions, err = saveMessage(hub, tx, &delivery.message, delivery.conversation)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&scheduled).Updates(map[string]interface{}{
+			"status":     models.ScheduledSent,
+			"message_id": delivery.message.ID,
+		}).Error
+	})
+
+	return delivery, err
+}
@@ -0,0 +1,154 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseSendAt(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+	now := time.Now()
+	tomorrow := now.Add(24 * time.Hour).Truncate(time.Second)
+	wallClock := tomorrow.In(tokyo).Format("2006-01-02T15:04:05")
+
+	tests := []struct {
+		name     string
+		value    string
+		timeZone string
+		want     time.Time // zero when an error is expected
+	}{
+		{"RFC 3339", tomorrow.Format(time.RFC3339), "", tomorrow},
+		{"RFC 3339 ignores the zone", tomorrow.Format(time.RFC3339), "Asia/Tokyo", tomorrow},
+		{"wall clock in zone", wallClock, "Asia/Tokyo", tomorrow},
+		{"wall clock without seconds", tomorrow.In(tokyo).Format("2006-01-02T15:04"), "Asia/Tokyo", tomorrow.Truncate(time.Minute)},
+		{"wall clock without zone", wallClock, "", time.Time{}},
+		{"unknown zone", wallClock, "Mars/Olympus", time.Time{}},
+		{"server local zone", wallClock, "Local", time.Time{}},
+		{"past", now.Add(-time.Minute).Format(time.RFC3339), "", time.Time{}},
+		{"more than a year ahead", now.Add(maxScheduleAhead + time.Hour).Format(time.RFC3339), "", time.Time{}},
+		{"garbage", "next tuesday", "", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSendAt(tt.value, tt.timeZone)
+			if tt.want.IsZero() {
+				if err == nil {
+					t.Errorf("parseSendAt(%q, %q) = %s, want an error", tt.value, tt.timeZone, got)
+				}
+				return
+			}
+			if err != nil || !got.Equal(tt.want) || got.Location() != time.UTC {
+				t.Errorf("parseSendAt(%q, %q) = %s, %v; want %s in UTC", tt.value, tt.timeZone, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func createTestScheduledMessage(t *testing.T, conversation models.Conversation, sender models.User, sendAt time.Time) models.ScheduledMessage {
+	t.Helper()
+
+	scheduled := models.ScheduledMessage{
+		ConversationID: conversation.ID,
+		SenderID:       sender.ID,
+		Content:        "later",
+		SendAt:         sendAt,
+		Status:         models.ScheduledPending,
+	}
+	if err := database.DB.Create(&scheduled).Error; err != nil {
+		t.Fatalf("create scheduled message: %v", err)
+	}
+	return scheduled
+}
+
+func TestDispatchScheduledMessagesSendsOnlyDueMessages(t *testing.T) {
+	useTestDB(t)
+
+	alice := createTestUser(t, "schedule_alice")
+	bob := createTestUser(t, "schedule_bob")
+	conversation := createTestConversation(t, models.DirectMessage, alice, bob)
+
+	due := createTestScheduledMessage(t, conversation, alice, time.Now().Add(-time.Second))
+	future := createTestScheduledMessage(t, conversation, alice, time.Now().Add(time.Hour))
+	cancelled := createTestScheduledMessage(t, conversation, alice, time.Now().Add(-time.Second))
+	database.DB.Model(&cancelled).Update("status", models.ScheduledCancelled)
+
+	hub := NewHub()
+	dispatchScheduledMessages(hub)
+
+	database.DB.First(&due, due.ID)
+	if due.Status != models.ScheduledSent || due.MessageID == nil {
+		t.Fatalf("due message is %s with message %v, want sent", due.Status, due.MessageID)
+	}
+	var message models.Message
+	if err := database.DB.First(&message, *due.MessageID).Error; err != nil || message.Content != "later" || message.SenderID != alice.ID {
+		t.Errorf("sent message = %+v (%v), want alice's scheduled content", message, err)
+	}
+	if events := drainEvents(t, hub); events[bob.ID]["type"] != "new_message" {
+		t.Errorf("recipient got %v, want new_message", events[bob.ID])
+	}
+
+	for _, scheduled := range []models.ScheduledMessage{future, cancelled} {
+		status := scheduled.Status
+		database.DB.First(&scheduled, scheduled.ID)
+		if scheduled.Status != status || scheduled.MessageID != nil {
+			t.Errorf("scheduled message %d became %s, want it left %s", scheduled.ID, scheduled.Status, status)
+		}
+	}
+}
+
+func TestCancelScheduledMessageOnlyCancelsOwnPendingMessages(t *testing.T) {
+	useTestDB(t)
+
+	alice := createTestUser(t, "cancel_alice")
+	bob := createTestUser(t, "cancel_bob")
+	conversation := createTestConversation(t, models.DirectMessage, alice, bob)
+	scheduled := createTestScheduledMessage(t, conversation, alice, time.Now().Add(time.Hour))
+	id := gin.Param{Key: "id", Value: strconv.FormatUint(uint64(scheduled.ID), 10)}
+
+	if recorder := callHandler(CancelScheduledMessage, bob, http.MethodDelete, "", id); recorder.Code != http.StatusNotFound {
+		t.Errorf("cancelling someone else's message = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+	if recorder := callHandler(CancelScheduledMessage, alice, http.MethodDelete, "", id); recorder.Code != http.StatusOK {
+		t.Errorf("cancel = %d %s, want %d", recorder.Code, recorder.Body, http.StatusOK)
+	}
+	if recorder := callHandler(CancelScheduledMessage, alice, http.MethodDelete, "", id); recorder.Code != http.StatusNotFound {
+		t.Errorf("cancelling twice = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+}
+
+func TestCreateScheduledMessageRejectsHiddenReplyTarget(t *testing.T) {
+	useTestDB(t)
+
+	alice := createTestUser(t, "reply_alice")
+	bob := createTestUser(t, "reply_bob")
+	carol := createTestUser(t, "reply_carol")
+	database.DB.Create(&models.UserBlock{BlockerID: alice.ID, BlockedID: bob.ID})
+	group := createTestConversation(t, models.GroupChat, alice, bob, carol)
+	hidden := createTestMessage(t, group, bob, "blocked sender")
+	visible := createTestMessage(t, group, carol, "visible")
+
+	schedule := func(replyToID uint) int {
+		body := fmt.Sprintf(`{"conversation_id": %d, "content": "reply", "reply_to_id": %d, "send_at": %q}`,
+			group.ID, replyToID, time.Now().Add(time.Hour).Format(time.RFC3339))
+		return callHandler(CreateScheduledMessage, alice, http.MethodPost, body).Code
+	}
+
+	if code := schedule(hidden.ID); code != http.StatusNotFound {
+		t.Errorf("reply to a blocked sender = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := schedule(visible.ID); code != http.StatusCreated {
+		t.Errorf("reply to a visible message = %d, want %d", code, http.StatusCreated)
+	}
+}
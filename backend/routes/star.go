@@ -0,0 +1,250 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultStarredLimit = 20
+	maxStarredLimit     = 50
+)
+
+// starredEntry is one entry of the starred listing: the message, where it
+// was sent and when the user starred it.
+type starredEntry struct {
+	Message      models.Message      `json:"message"`
+	Conversation starredConversation `json:"conversation"`
+	StarredAt    time.Time           `json:"starred_at"`
+}
+
+// starredConversation is the conversation context shown with a starred
+// message; direct conversations are named by their participants.
+type starredConversation struct {
+	ID           uint                    `json:"id"`
+	Type         models.ConversationType `json:"type"`
+	Name         string                  `json:"name,omitempty"`
+	Avatar       string                  `json:"avatar,omitempty"`
+	Participants []models.User           `json:"participants,omitempty"`
+}
+
+// StarMessage adds a message to the current user's starred collection.
+// Starring a message twice is not an error.
+func StarMessage(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	var message models.Message
+	if err := database.DB.
+		Scopes(visibleMessages(user.ID)).
+		Where("messages.id = ? AND messages.type <> ?", messageID, models.SystemMessage).
+		First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to star message"})
+		}
+		return
+	}
+
+	star := models.StarredMessage{UserID: user.ID, MessageID: message.ID}
+	if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&star).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to star message"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message starred"})
+}
+
+// UnstarMessage removes a message from the current user's starred collection.
+func UnstarMessage(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	if err := database.DB.
+		Where("user_id = ? AND message_id = ?", user.ID, messageID).
+		Delete(&models.StarredMessage{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unstar message"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message unstarred"})
+}
+
+// GetStarredMessages lists the current user's starred messages across all
+// conversations, most recently starred first, paginated with limit and
+// offset and optionally filtered by search. Stars on messages the user can
+// no longer see (deleted, expired, from a conversation they left or from a
+// sender they blocked) are left out.
+func GetStarredMessages(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultStarredLimit)))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	if limit > maxStarredLimit {
+		limit = maxStarredLimit
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+
+	query := database.DB.Model(&models.Message{}).
+		Select("messages.id, starred_messages.created_at").
+		Joins("JOIN starred_messages ON starred_messages.message_id = messages.id AND starred_messages.user_id = ?", user.ID).
+		Scopes(visibleMessages(user.ID))
+
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		query = query.Where("messages.content ILIKE ?", "%"+escapeLike(search)+"%")
+	}
+
+	// Fetch one extra row to know whether there is another page
+	var stars []struct {
+		ID        uint
+		CreatedAt time.Time
+	}
+	if err := query.
+		Order("starred_messages.created_at DESC, messages.id DESC").
+		Limit(limit + 1).Offset(offset).
+		Scan(&stars).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch starred messages"})
+		return
+	}
+
+	response := gin.H{}
+	if len(stars) > limit {
+		stars = stars[:limit]
+		response["next_offset"] = offset + limit
+	}
+
+	messageIDs := make([]uint, len(stars))
+	for i, star := range stars {
+		messageIDs[i] = star.ID
+	}
+
+	var messages []models.Message
+	if len(messageIDs) > 0 {
+		if err := database.DB.
+			Where("id IN ?", messageIDs).
+			Preload("Sender").
+			Preload("ReplyTo", unexpiredMessages).
+			Preload("Pin.PinnedBy").
+			Preload("LinkPreview").
+			Find(&messages).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch starred messages"})
+			return
+		}
+	}
+
+	maskSenderPresence(messages, user.ID)
+	attachEntities(messages)
+	attachPolls(messages, user.ID)
+	attachVoicePlays(messages, user.ID)
+
+	conversations, err := starredConversations(messages, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch starred messages"})
+		return
+	}
+
+	byID := make(map[uint]models.Message, len(messages))
+	for _, message := range messages {
+		message.Starred = true
+		byID[message.ID] = message
+	}
+
+	starred := make([]starredEntry, 0, len(stars))
+	for _, star := range stars {
+		message, ok := byID[star.ID]
+		if !ok {
+			continue // Deleted between the two queries
+		}
+		starred = append(starred, starredEntry{
+			Message:      message,
+			Conversation: conversations[message.ConversationID],
+			StarredAt:    star.CreatedAt,
+		})
+	}
+
+	response["starred"] = starred
+	c.JSON(http.StatusOK, response)
+}
+
+// starredConversations loads the conversations of messages with their
+// participants, keyed by ID.
+func starredConversations(messages []models.Message, viewerID uint) (map[uint]starredConversation, error) {
+	ids := idSet(nil)
+	for _, message := range messages {
+		ids[message.ConversationID] = true
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var conversations []models.Conversation
+	if err := database.DB.Where("id IN ?", mapKeys(ids)).Preload("Participants").Find(&conversations).Error; err != nil {
+		return nil, err
+	}
+
+	result := make(map[uint]starredConversation, len(conversations))
+	for _, conversation := range conversations {
+		maskPresence(conversation.Participants, viewerID)
+		result[conversation.ID] = starredConversation{
+			ID:           conversation.ID,
+			Type:         conversation.Type,
+			Name:         conversation.Name,
+			Avatar:       conversation.Avatar,
+			Participants: conversation.Participants,
+		}
+	}
+	return result, nil
+}
+
+// attachStars marks the messages viewerID starred.
+func attachStars(messages []models.Message, viewerID uint) {
+	if len(messages) == 0 {
+		return
+	}
+	ids := make([]uint, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+	}
+
+	var starredIDs []uint
+	database.DB.Model(&models.StarredMessage{}).
+		Where("user_id = ? AND message_id IN ?", viewerID, ids).
+		Pluck("message_id", &starredIDs)
+
+	starred := idSet(starredIDs)
+	for i := range messages {
+		messages[i].Starred = starred[messages[i].ID]
+	}
+}
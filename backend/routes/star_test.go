@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func listStarred(user models.User, query string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/messages/starred?"+query, nil)
+	c.Set("user", user)
+	GetStarredMessages(c)
+	return recorder
+}
+
+func messageParam(message models.Message) gin.Param {
+	return gin.Param{Key: "id", Value: strconv.FormatUint(uint64(message.ID), 10)}
+}
+
+func TestGetStarredMessagesRejectsInvalidPaging(t *testing.T) {
+	// Rejected before the query runs, so no database is needed
+	for _, query := range []string{"limit=0", "limit=abc", "offset=-1", "offset=x"} {
+		if recorder := listStarred(models.User{ID: 1}, query); recorder.Code != http.StatusBadRequest {
+			t.Errorf("GET /messages/starred?%s = %d, want %d", query, recorder.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestStarMessageRequiresAVisibleMessage(t *testing.T) {
+	useTestDB(t)
+
+	alice := createTestUser(t, "star_alice")
+	bob := createTestUser(t, "star_bob")
+	carol := createTestUser(t, "star_carol")
+	outsider := createTestUser(t, "star_outsider")
+	database.DB.Create(&models.UserBlock{BlockerID: alice.ID, BlockedID: bob.ID})
+
+	group := createTestConversation(t, models.GroupChat, alice, bob, carol)
+	fromBob := createTestMessage(t, group, bob, "from bob")
+	fromCarol := createTestMessage(t, group, carol, "from carol")
+	system := createTestMessage(t, group, carol, "carol joined")
+	database.DB.Model(&system).Update("type", models.SystemMessage)
+
+	tests := []struct {
+		name    string
+		user    models.User
+		message models.Message
+		status  int
+	}{
+		{"visible message", alice, fromCarol, http.StatusOK},
+		{"starred twice", alice, fromCarol, http.StatusOK},
+		{"blocked sender", alice, fromBob, http.StatusNotFound},
+		{"system message", alice, system, http.StatusNotFound},
+		{"not a participant", outsider, fromCarol, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if recorder := callHandler(StarMessage, tt.user, http.MethodPost, "", messageParam(tt.message)); recorder.Code != tt.status {
+			t.Errorf("%s: star = %d, want %d", tt.name, recorder.Code, tt.status)
+		}
+	}
+
+	var count int64
+	database.DB.Model(&models.StarredMessage{}).Where("message_id = ?", fromCarol.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("message has %d stars, want 1", count)
+	}
+}
+
+func TestGetStarredMessagesListsOnlyVisibleStars(t *testing.T) {
+	useTestDB(t)
+
+	alice := createTestUser(t, "starred_alice")
+	bob := createTestUser(t, "starred_bob")
+	carol := createTestUser(t, "starred_carol")
+
+	group := createTestConversation(t, models.GroupChat, alice, bob, carol)
+	left := createTestConversation(t, models.GroupChat, carol, alice)
+	older := createTestMessage(t, group, carol, "older note")
+	newer := createTestMessage(t, group, carol, "newer note")
+	fromBob := createTestMessage(t, group, bob, "from bob")
+	deleted := createTestMessage(t, group, carol, "deleted")
+	expired := createTestMessage(t, group, carol, "expired")
+	inLeft := createTestMessage(t, left, carol, "before alice left")
+
+	starredAt := time.Now().Add(-time.Hour)
+	for i, message := range []models.Message{older, newer, fromBob, deleted, expired, inLeft} {
+		database.DB.Create(&models.StarredMessage{UserID: alice.ID, MessageID: message.ID, CreatedAt: starredAt.Add(time.Duration(i) * time.Minute)})
+	}
+	// Bob's star on the same message is his own
+	database.DB.Create(&models.StarredMessage{UserID: bob.ID, MessageID: older.ID})
+
+	database.DB.Create(&models.UserBlock{BlockerID: alice.ID, BlockedID: bob.ID})
+	database.DB.Delete(&deleted)
+	database.DB.Model(&expired).Update("expires_at", time.Now().Add(-time.Minute))
+	database.DB.Model(&left).Association("Participants").Delete(&alice)
+
+	decode := func(recorder *httptest.ResponseRecorder) ([]uint, *int) {
+		t.Helper()
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("starred = %d %s", recorder.Code, recorder.Body)
+		}
+		var body struct {
+			Starred []struct {
+				Message      models.Message `json:"message"`
+				Conversation struct {
+					ID uint `json:"id"`
+				} `json:"conversation"`
+			} `json:"starred"`
+			NextOffset *int `json:"next_offset"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		var ids []uint
+		for _, entry := range body.Starred {
+			if !entry.Message.Starred || entry.Conversation.ID != entry.Message.ConversationID {
+				t.Errorf("entry for message %d = %+v, want it starred with its conversation", entry.Message.ID, entry)
+			}
+			ids = append(ids, entry.Message.ID)
+		}
+		return ids, body.NextOffset
+	}
+
+	ids, next := decode(listStarred(alice, ""))
+	if len(ids) != 2 || ids[0] != newer.ID || ids[1] != older.ID || next != nil {
+		t.Errorf("alice's stars = %v (next %v), want %d then %d", ids, next, newer.ID, older.ID)
+	}
+
+	ids, next = decode(listStarred(alice, "limit=1"))
+	if len(ids) != 1 || ids[0] != newer.ID || next == nil || *next != 1 {
+		t.Errorf("first page = %v (next %v), want %d with next offset 1", ids, next, newer.ID)
+	}
+
+	ids, _ = decode(listStarred(alice, "search=older"))
+	if len(ids) != 1 || ids[0] != older.ID {
+		t.Errorf("search = %v, want %d", ids, older.ID)
+	}
+
+	if recorder := callHandler(UnstarMessage, alice, http.MethodDelete, "", messageParam(older)); recorder.Code != http.StatusOK {
+		t.Fatalf("unstar = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	if ids, _ := decode(listStarred(bob, "")); len(ids) != 1 || ids[0] != older.ID {
+		t.Errorf("bob's stars after alice unstarred = %v, want %d", ids, older.ID)
+	}
+}
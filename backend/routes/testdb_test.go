@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"chat-backend/database"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var migrateTestDB sync.Once
+
+// useTestDB points database.DB at a transaction on TEST_DATABASE_URL that is
+// rolled back when the test ends. Tests that need Postgres are skipped when
+// the variable is not set.
+func useTestDB(t *testing.T) {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	migrateTestDB.Do(database.Migrate)
+
+	tx := db.Begin()
+	database.DB = tx
+	t.Cleanup(func() {
+		tx.Rollback()
+		database.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
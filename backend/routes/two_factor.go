@@ -0,0 +1,398 @@
+package routes
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"chat-backend/config"
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	totpPeriod = 30 // seconds per time step
+	totpDigits = 6
+	totpSkew   = 1 // accept codes from one step before/after to allow for clock drift
+
+	backupCodeCount = 10
+
+	challengeTokenAudience = "go-chat/2fa-challenge"
+	challengeTokenTTL      = 5 * time.Minute
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorInput struct {
+	Password   string `json:"password" binding:"required"`
+	Code       string `json:"code"`
+	BackupCode string `json:"backup_code"`
+}
+
+type LoginTwoFactorInput struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	BackupCode     string `json:"backup_code"`
+}
+
+// EnrollTwoFactor generates a new TOTP secret for the current user. 2FA is not
+// enabled until the secret is confirmed with a valid code.
+func EnrollTwoFactor(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	if err := database.DB.Model(&user).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": totpURI(secret, user.Email),
+	})
+}
+
+// ConfirmTwoFactor enables 2FA once the user proves their authenticator works
+// and returns a fresh set of backup codes. The codes are only shown once.
+func ConfirmTwoFactor(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var input TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor enrollment has not been started"})
+		return
+	}
+
+	step, ok := validateTOTP(user.TOTPSecret, input.Code, user.TOTPLastStep)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, err := replaceBackupCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate backup codes"})
+		return
+	}
+
+	if err := database.DB.Model(&user).Updates(map[string]interface{}{
+		"two_factor_enabled": true,
+		"totp_last_step":     step,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Two-factor authentication enabled",
+		"backup_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns 2FA off. It requires the account password and either
+// a current TOTP code or an unused backup code.
+func DisableTwoFactor(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var input DisableTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !user.TwoFactorEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if err := user.CheckPassword(input.Password); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	if !verifySecondFactor(&user, input.Code, input.BackupCode) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	if err := database.DB.Where("user_id = ?", user.ID).Delete(&models.BackupCode{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	if err := database.DB.Model(&user).Updates(map[string]interface{}{
+		"two_factor_enabled": false,
+		"totp_secret":        "",
+		"totp_last_step":     0,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// LoginTwoFactor completes a login started by Login for users with 2FA enabled.
+func LoginTwoFactor(c *gin.Context) {
+	var input LoginTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := parseChallengeToken(input.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil || !user.TwoFactorEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	// Codes are only six digits, so second-factor failures count against the account too
+	attempt, wait := getLoginThrottle().reserve(c.ClientIP(), user.Email)
+	if wait > 0 {
+		abortTooManyAttempts(c, wait)
+		return
+	}
+
+	if !verifySecondFactor(&user, input.Code, input.BackupCode) {
+		attempt.fail(&user.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	attempt.succeed(user.ID)
+
+	token, err := generateToken(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":  ownProfile(user),
+		"token": token,
+	})
+}
+
+// verifySecondFactor checks a TOTP code, falling back to a backup code.
+// Accepted TOTP steps and backup codes are consumed so they cannot be replayed.
+func verifySecondFactor(user *models.User, code, backupCode string) bool {
+	if code != "" {
+		step, ok := validateTOTP(user.TOTPSecret, code, user.TOTPLastStep)
+		if !ok {
+			return false
+		}
+
+		// Conditional update so two concurrent requests cannot both use the same step
+		result := database.DB.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return false
+		}
+		user.TOTPLastStep = step
+		return true
+	}
+
+	if backupCode != "" {
+		result := database.DB.Model(&models.BackupCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashBackupCode(backupCode)).
+			Update("used_at", time.Now())
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	return false
+}
+
+func generateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base32NoPadding.EncodeToString(secret), nil
+}
+
+func totpURI(secret, accountName string) string {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "Go Chat"
+	}
+
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + accountName,
+		RawQuery: params.Encode(),
+	}
+	return uri.String()
+}
+
+// totpCode computes the RFC 6238 code for the given time step.
+func totpCode(secret string, step int64) (string, error) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// validateTOTP returns the matching time step if code is valid and newer than lastStep.
+func validateTOTP(secret, code string, lastStep int64) (int64, bool) {
+	return validateTOTPAt(secret, code, lastStep, time.Now())
+}
+
+func validateTOTPAt(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if secret == "" || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// replaceBackupCodes discards any existing backup codes and stores a new set,
+// returning the plaintext codes.
+func replaceBackupCodes(userID uint) ([]string, error) {
+	codes := make([]string, 0, backupCodeCount)
+	records := make([]models.BackupCode, 0, backupCodeCount)
+
+	for i := 0; i < backupCodeCount; i++ {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32NoPadding.EncodeToString(raw))
+		code = code[:4] + "-" + code[4:]
+
+		codes = append(codes, code)
+		records = append(records, models.BackupCode{
+			UserID:   userID,
+			CodeHash: hashBackupCode(code),
+		})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.BackupCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&records).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func hashBackupCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateChallengeToken issues a short-lived token proving the password step
+// of a 2FA login succeeded. AuthMiddleware rejects it as an access token.
+func generateChallengeToken(userID uint) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"exp":     time.Now().Add(challengeTokenTTL).Unix(),
+	}
+
+	return config.SignToken(claims, challengeTokenAudience)
+}
+
+func parseChallengeToken(tokenString string) (uint, error) {
+	claims, err := config.ParseToken(tokenString, challengeTokenAudience)
+	if err != nil {
+		return 0, fmt.Errorf("invalid challenge token")
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("invalid challenge token")
+	}
+
+	return uint(userID), nil
+}
@@ -0,0 +1,176 @@
+package routes
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+)
+
+// rfc6238Secret is the SHA-1 seed "12345678901234567890" from RFC 6238
+// appendix B, base32 encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	// The RFC lists 8-digit codes; 6-digit codes are their last six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := totpCode(rfc6238Secret, tt.unix/totpPeriod)
+		if err != nil {
+			t.Fatalf("totpCode(%d): %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("totpCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"two steps early", -2, false},
+		{"one step early", -1, true},
+		{"current step", 0, true},
+		{"one step late", 1, true},
+		{"two steps late", 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := totpCode(rfc6238Secret, current+tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			step, ok := validateTOTPAt(rfc6238Secret, code, 0, now)
+			if ok != tt.ok {
+				t.Fatalf("validateTOTPAt ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && step != current+tt.offset {
+				t.Errorf("step = %d, want %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	for _, code := range []string{"", "05047", "0504711", "abcdef"} {
+		if _, ok := validateTOTPAt(rfc6238Secret, code, 0, now); ok {
+			t.Errorf("code %q was accepted", code)
+		}
+	}
+	if _, ok := validateTOTPAt("", "050471", 0, now); ok {
+		t.Error("code was accepted without a secret")
+	}
+	if _, ok := validateTOTPAt(rfc6238Secret, "050 471", 0, now); !ok {
+		t.Error("code with a space was rejected")
+	}
+}
+
+func TestValidateTOTPReplay(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	step, ok := validateTOTPAt(rfc6238Secret, "050471", 0, now)
+	if !ok {
+		t.Fatal("first use was rejected")
+	}
+	if _, ok := validateTOTPAt(rfc6238Secret, "050471", step, now); ok {
+		t.Error("code was accepted again after its step was recorded")
+	}
+
+	// An older code inside the skew window is refused once a newer step was used
+	previous, _ := totpCode(rfc6238Secret, current-1)
+	if _, ok := validateTOTPAt(rfc6238Secret, previous, current, now); ok {
+		t.Error("code from before the last accepted step was accepted")
+	}
+}
+
+func createTestUser(t *testing.T, username string) models.User {
+	t.Helper()
+
+	user := models.User{Username: username, Email: username + "@example.com", Password: "-"}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func TestVerifySecondFactorConsumesTOTPStep(t *testing.T) {
+	useTestDB(t)
+
+	user := createTestUser(t, "totp_replay")
+	user.TOTPSecret = rfc6238Secret
+	user.TwoFactorEnabled = true
+	database.DB.Model(&user).Updates(map[string]interface{}{"totp_secret": user.TOTPSecret, "two_factor_enabled": true})
+
+	code, err := totpCode(rfc6238Secret, time.Now().Unix()/totpPeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifySecondFactor(&user, code, "") {
+		t.Fatal("valid code was rejected")
+	}
+
+	// A second request holding a stale copy of the user must not reuse the step
+	var stale models.User
+	database.DB.First(&stale, user.ID)
+	stale.TOTPLastStep = 0
+	if verifySecondFactor(&stale, code, "") {
+		t.Error("code was accepted twice")
+	}
+}
+
+func TestBackupCodesAreSingleUse(t *testing.T) {
+	useTestDB(t)
+
+	user := createTestUser(t, "backup_codes")
+	codes, err := replaceBackupCodes(user.ID)
+	if err != nil {
+		t.Fatalf("replaceBackupCodes: %v", err)
+	}
+	if len(codes) != backupCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), backupCodeCount)
+	}
+
+	if !verifySecondFactor(&user, "", codes[0]) {
+		t.Fatal("unused backup code was rejected")
+	}
+	if verifySecondFactor(&user, "", codes[0]) {
+		t.Error("backup code was accepted twice")
+	}
+
+	// Codes are matched case- and dash-insensitively
+	relaxed := strings.ToUpper(strings.ReplaceAll(codes[1], "-", ""))
+	if !verifySecondFactor(&user, "", relaxed) {
+		t.Error("backup code typed without dash in upper case was rejected")
+	}
+
+	// Generating a new set invalidates the old one
+	if _, err := replaceBackupCodes(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if verifySecondFactor(&user, "", codes[2]) {
+		t.Error("backup code from a replaced set was accepted")
+	}
+}
@@ -0,0 +1,147 @@
+package routes
+
+import (
+	"encoding/json"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+)
+
+// typingKey identifies one user typing in one conversation.
+type typingKey struct {
+	userID         uint
+	conversationID uint
+}
+
+// typingState is owned by the hub goroutine.
+type typingState struct {
+	client     *Client // the connection that last reported typing
+	recipients []uint
+	typing     bool
+	expiresAt  time.Time
+	lastStart  time.Time
+}
+
+// typingUpdate is a typing_start or typing_stop frame, already checked
+// against the conversation's participants by the client goroutine.
+type typingUpdate struct {
+	client         *Client
+	userID         uint
+	conversationID uint
+	recipients     []uint
+	typing         bool
+}
+
+// handleTypingUpdate records a start or stop frame. A start while already
+// typing only extends the expiry; a fresh start within TYPING_THROTTLE of the
+// previous one is dropped so toggling clients cannot flood the conversation.
+func (h *Hub) handleTypingUpdate(update typingUpdate) {
+	key := typingKey{userID: update.userID, conversationID: update.conversationID}
+	state := h.typingStates[key]
+	now := time.Now()
+
+	if !update.typing {
+		if state != nil && state.typing {
+			state.typing = false
+			h.sendTypingEvent("typing_stop", key, state.recipients)
+		}
+		return
+	}
+
+	if state == nil {
+		state = &typingState{}
+		h.typingStates[key] = state
+	}
+
+	if state.typing {
+		state.client = update.client
+		state.recipients = update.recipients
+		state.expiresAt = now.Add(h.typingTimeout)
+		return
+	}
+
+	if now.Sub(state.lastStart) < h.typingThrottle {
+		return
+	}
+
+	state.client = update.client
+	state.recipients = update.recipients
+	state.typing = true
+	state.lastStart = now
+	state.expiresAt = now.Add(h.typingTimeout)
+	h.sendTypingEvent("typing_start", key, state.recipients)
+}
+
+// expireTyping emits typing_stop for users who went quiet and forgets idle
+// entries once their throttle window has passed.
+func (h *Hub) expireTyping(now time.Time) {
+	for key, state := range h.typingStates {
+		if state.typing && now.After(state.expiresAt) {
+			state.typing = false
+			h.sendTypingEvent("typing_stop", key, state.recipients)
+		}
+		if !state.typing && now.Sub(state.lastStart) >= h.typingThrottle {
+			delete(h.typingStates, key)
+		}
+	}
+}
+
+// stopTyping ends the typing indicators reported by a disconnecting
+// connection. Indicators refreshed by the user's other devices stay up.
+func (h *Hub) stopTyping(client *Client) {
+	for key, state := range h.typingStates {
+		if state.client != client {
+			continue
+		}
+		if state.typing {
+			h.sendTypingEvent("typing_stop", key, state.recipients)
+		}
+		delete(h.typingStates, key)
+	}
+}
+
+func (h *Hub) sendTypingEvent(eventType string, key typingKey, recipients []uint) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":            eventType,
+		"conversation_id": key.conversationID,
+		"user_id":         key.userID,
+	})
+
+	for _, userID := range recipients {
+		h.sendToUser(userID, payload, nil)
+	}
+}
+
+func (c *Client) handleTyping(wsMsg WSMessage, typing bool) {
+	update := typingUpdate{
+		client:         c,
+		userID:         c.userID,
+		conversationID: wsMsg.ConversationID,
+		typing:         typing,
+	}
+
+	// Stops reuse the recipients stored with the start
+	if typing {
+		var conversation models.Conversation
+		if err := database.DB.Preload("Participants").First(&conversation, wsMsg.ConversationID).Error; err != nil {
+			return
+		}
+
+		blockers := blockerIDsOf(c.userID)
+
+		isParticipant := false
+		for _, participant := range conversation.Participants {
+			if participant.ID == c.userID {
+				isParticipant = true
+			} else if !blockers[participant.ID] {
+				update.recipients = append(update.recipients, participant.ID)
+			}
+		}
+		if !isParticipant {
+			return
+		}
+	}
+
+	c.hub.typing <- update
+}
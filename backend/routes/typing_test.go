@@ -0,0 +1,98 @@
+package routes
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// connectTestClient registers a connection on the hub without a socket.
+func connectTestClient(hub *Hub, userID uint) *Client {
+	client := &Client{hub: hub, send: make(chan []byte, 16), userID: userID}
+	hub.clients[client] = true
+	if hub.userClients[userID] == nil {
+		hub.userClients[userID] = map[*Client]bool{}
+	}
+	hub.userClients[userID][client] = true
+	return client
+}
+
+// receivedTypes lists the event types queued for client.
+func receivedTypes(t *testing.T, client *Client) []string {
+	t.Helper()
+
+	var types []string
+	for {
+		select {
+		case payload := <-client.send:
+			var event struct{ Type string }
+			if err := json.Unmarshal(payload, &event); err != nil {
+				t.Fatal(err)
+			}
+			types = append(types, event.Type)
+		default:
+			return types
+		}
+	}
+}
+
+func TestTypingStartIsThrottledAndRefreshed(t *testing.T) {
+	hub := NewHub()
+	hub.typingThrottle = time.Hour
+	typist := connectTestClient(hub, 1)
+	watcher := connectTestClient(hub, 2)
+
+	start := typingUpdate{client: typist, userID: 1, conversationID: 7, recipients: []uint{2}, typing: true}
+	stop := start
+	stop.typing = false
+
+	hub.handleTypingUpdate(start)
+	hub.handleTypingUpdate(start) // Refresh while typing
+	hub.handleTypingUpdate(stop)
+	hub.handleTypingUpdate(start) // Restart within the throttle window
+
+	got := receivedTypes(t, watcher)
+	if len(got) != 2 || got[0] != "typing_start" || got[1] != "typing_stop" {
+		t.Errorf("watcher received %v, want one typing_start and one typing_stop", got)
+	}
+}
+
+func TestTypingExpires(t *testing.T) {
+	hub := NewHub()
+	typist := connectTestClient(hub, 1)
+	watcher := connectTestClient(hub, 2)
+
+	hub.handleTypingUpdate(typingUpdate{client: typist, userID: 1, conversationID: 7, recipients: []uint{2}, typing: true})
+	receivedTypes(t, watcher)
+
+	hub.expireTyping(time.Now())
+	if got := receivedTypes(t, watcher); len(got) != 0 {
+		t.Fatalf("typing stopped before the timeout: %v", got)
+	}
+	hub.expireTyping(time.Now().Add(hub.typingTimeout + time.Second))
+	if got := receivedTypes(t, watcher); len(got) != 1 || got[0] != "typing_stop" {
+		t.Errorf("after the timeout watcher received %v, want typing_stop", got)
+	}
+}
+
+func TestTypingStopsWhenTheTypingConnectionCloses(t *testing.T) {
+	hub := NewHub()
+	phone := connectTestClient(hub, 1)
+	laptop := connectTestClient(hub, 1)
+	watcher := connectTestClient(hub, 2)
+
+	hub.handleTypingUpdate(typingUpdate{client: phone, userID: 1, conversationID: 7, recipients: []uint{2}, typing: true})
+	receivedTypes(t, watcher)
+
+	// Another device going away does not end the indicator
+	hub.stopTyping(laptop)
+	if got := receivedTypes(t, watcher); len(got) != 0 {
+		t.Fatalf("closing an idle device sent %v", got)
+	}
+
+	// The typing device going away does, while the user stays connected
+	hub.stopTyping(phone)
+	if got := receivedTypes(t, watcher); len(got) != 1 || got[0] != "typing_stop" {
+		t.Errorf("closing the typing device sent %v, want typing_stop", got)
+	}
+}
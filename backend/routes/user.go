@@ -2,13 +2,40 @@ package routes
 
 import (
 	"net/http"
+	"strings"
+	"time"
 
+	"chat-backend/config"
 	"chat-backend/database"
 	"chat-backend/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+type UpdateProfileInput struct {
+	Username    *string `json:"username" binding:"omitempty,min=3,max=50"`
+	DisplayName *string `json:"display_name" binding:"omitempty,max=100"`
+	Bio         *string `json:"bio" binding:"omitempty,max=500"`
+	Phone       *string `json:"phone" binding:"omitempty,max=50"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// selfProfile is how users see their own account: the public profile plus
+// settings that are never shown to other users.
+type selfProfile struct {
+	models.User
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
+}
+
+func ownProfile(user models.User) selfProfile {
+	return selfProfile{User: user, TwoFactorEnabled: user.TwoFactorEnabled}
+}
+
 func GetCurrentUser(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
@@ -16,27 +43,269 @@ func GetCurrentUser(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"user": user})
+	c.JSON(http.StatusOK, gin.H{"user": ownProfile(user.(models.User))})
+}
+
+// ChangePassword updates the current user's password and revokes every other
+// active token, including personal access tokens, unused WebSocket tickets and
+// open WebSocket connections. A fresh token is returned so the calling session
+// stays logged in. Wrong current passwords count towards the login throttle.
+func ChangePassword(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var input ChangePasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A stolen session must not give unlimited guesses at the password
+	attempt, wait := getLoginThrottle().reserve(c.ClientIP(), user.Email)
+	if wait > 0 {
+		abortTooManyAttempts(c, wait)
+		return
+	}
+	if err := user.CheckPassword(input.CurrentPassword); err != nil {
+		attempt.fail(&user.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	attempt.succeed(user.ID)
+
+	if input.NewPassword == input.CurrentPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New password must be different from the current password"})
+		return
+	}
+
+	if err := config.ValidatePassword(input.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := user.HashPassword(input.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	// Tokens carry whole-second iat claims and everything issued up to and
+	// including revokedAt is rejected, so the caller's new token is dated one
+	// second later
+	revokedAt := time.Now().Truncate(time.Second)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"password":          user.Password,
+			"tokens_revoked_at": revokedAt,
+		}).Error; err != nil {
+			return err
+		}
+		// Personal access tokens are revoked too; tokens of the user's bots
+		// belong to the bot accounts and keep working
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.PersonalAccessToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.WSTicket{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	// Every open connection was authorized by a now revoked token, the
+	// caller's included; its client reconnects with the new token
+	hub.DisconnectUser(user.ID)
+
+	token, err := issueToken(user.ID, revokedAt.Add(time.Second))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password changed successfully",
+		"token":   token,
+	})
+}
+
+// UpdateProfile applies a partial update to the current user's profile and
+// notifies everyone who shares a conversation with them.
+func UpdateProfile(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	var input UpdateProfileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+
+	if input.Username != nil {
+		username := strings.TrimSpace(*input.Username)
+		if len(username) < 3 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Username must be at least 3 characters"})
+			return
+		}
+		if isReservedUsername(username) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Username is reserved"})
+			return
+		}
+		if username != user.Username {
+			if taken, err := profileFieldTaken("username", username, user.ID); err != nil || taken {
+				respondProfileConflict(c, err, "Username already taken")
+				return
+			}
+			updates["username"] = username
+		}
+	}
+
+	if input.Phone != nil {
+		phone := strings.TrimSpace(*input.Phone)
+		if phone != "" && phone != user.Phone {
+			if taken, err := profileFieldTaken("phone", phone, user.ID); err != nil || taken {
+				respondProfileConflict(c, err, "Phone number already in use")
+				return
+			}
+		}
+		updates["phone"] = phone
+	}
+
+	if input.DisplayName != nil {
+		updates["display_name"] = strings.TrimSpace(*input.DisplayName)
+	}
+
+	if input.Bio != nil {
+		updates["bio"] = strings.TrimSpace(*input.Bio)
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusOK, gin.H{"user": ownProfile(user)})
+		return
+	}
+
+	if err := database.DB.Model(&user).Updates(updates).Error; err != nil {
+		// The unique indexes still catch a race between the check and the update
+		c.JSON(http.StatusConflict, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	database.DB.First(&user, user.ID)
+	broadcastProfileUpdate(hub, user)
+
+	c.JSON(http.StatusOK, gin.H{"user": ownProfile(user)})
 }
 
-func GetUsers(c *gin.Context) {
+// UploadAvatar replaces the current user's avatar with an uploaded image
+// (multipart field "avatar"), resized server-side.
+func UploadAvatar(hub *Hub, c *gin.Context) {
 	currentUser, _ := c.Get("user")
-	currentUserData := currentUser.(models.User)
+	user := currentUser.(models.User)
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, avatarMaxBytes+(1<<20))
+
+	file, _, err := c.Request.FormFile("avatar")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar image is required"})
+		return
+	}
+	defer file.Close()
+
+	name, err := processAvatar(file, user.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	search := c.Query("search")
+	previous := user.Avatar
+	user.Avatar = avatarURLPrefix + name
+	if err := database.DB.Model(&user).Update("avatar", user.Avatar).Error; err != nil {
+		removeAvatarFile(user.Avatar)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update avatar"})
+		return
+	}
+	removeAvatarFile(previous)
+
+	broadcastProfileUpdate(hub, user)
 
-	var users []models.User
-	query := database.DB.Where("id != ?", currentUserData.ID)
+	c.JSON(http.StatusOK, gin.H{"user": ownProfile(user)})
+}
+
+// DeleteAvatar clears the current user's avatar.
+func DeleteAvatar(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
 
-	if search != "" {
-		searchPattern := "%" + search + "%"
-		query = query.Where("username ILIKE ? OR email ILIKE ? OR phone ILIKE ?", searchPattern, searchPattern, searchPattern)
+	previous := user.Avatar
+	user.Avatar = ""
+	if err := database.DB.Model(&user).Update("avatar", "").Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove avatar"})
+		return
 	}
+	removeAvatarFile(previous)
+
+	broadcastProfileUpdate(hub, user)
+
+	c.JSON(http.StatusOK, gin.H{"user": ownProfile(user)})
+}
+
+func profileFieldTaken(column, value string, userID uint) (bool, error) {
+	var count int64
+	err := database.DB.Model(&models.User{}).
+		Where(column+" = ? AND id != ?", value, userID).
+		Count(&count).Error
+	return count > 0, err
+}
 
-	if err := query.Find(&users).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+func respondProfileConflict(c *gin.Context, err error, message string) {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
 		return
 	}
+	c.JSON(http.StatusConflict, gin.H{"error": message})
+}
+
+// conversationPeerIDs returns every user who shares at least one conversation
+// with userID, including userID itself.
+func conversationPeerIDs(userID uint) []uint {
+	var ids []uint
+	database.DB.Table("conversation_participants").
+		Distinct("user_id").
+		Where("conversation_id IN (?)",
+			database.DB.Table("conversation_participants").Select("conversation_id").Where("user_id = ?", userID)).
+		Pluck("user_id", &ids)
+
+	if len(ids) == 0 {
+		ids = []uint{userID}
+	}
+	return ids
+}
+
+// publicUser is the part of a profile that is pushed to other users in
+// events. Email, phone and presence are left out.
+type publicUser struct {
+	ID          uint   `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	Avatar      string `json:"avatar"`
+}
+
+func newPublicUser(user models.User) publicUser {
+	return publicUser{
+		ID:          user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		Avatar:      user.Avatar,
+	}
+}
 
-	c.JSON(http.StatusOK, gin.H{"users": users})
+// broadcastProfileUpdate sends the public parts of a profile to the user's
+// conversation peers.
+func broadcastProfileUpdate(hub *Hub, user models.User) {
+	hub.SendToUsers(conversationPeerIDs(user.ID), map[string]interface{}{
+		"type": "user_updated",
+		"user": newPublicUser(user),
+	})
 }
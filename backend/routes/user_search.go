@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultUserSearchLimit = 20
+	maxUserSearchLimit     = 50
+
+	// Shorter terms are matched by prefix only; trigram matching needs at
+	// least three characters to use the index
+	minTrigramSearchLength = 3
+)
+
+// GetUsers searches the user directory. Results are paginated with limit and
+// offset and ranked with exact matches first, then prefix matches, then
+// fuzzy matches, with the caller's contacts ahead of strangers in each group.
+// Email and phone are only returned for a user whose email or phone exactly
+// matches the search term. Without a search term, contacts are listed first.
+func GetUsers(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultUserSearchLimit)))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	if limit > maxUserSearchLimit {
+		limit = maxUserSearchLimit
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+
+	search := strings.TrimSpace(c.Query("search"))
+	term := strings.ToLower(search)
+
+	query := database.DB.Model(&models.User{}).
+		Joins("LEFT JOIN contacts ON contacts.user_id = ? AND contacts.contact_id = users.id", user.ID).
+		Where("users.id <> ?", user.ID).
+		Where("users.id NOT IN (?)", database.DB.Model(&models.UserBlock{}).Select("blocker_id").Where("blocked_id = ?", user.ID))
+
+	if term == "" {
+		query = query.
+			Select("users.*, contacts.contact_id IS NOT NULL AS is_contact").
+			Order("is_contact DESC, users.username")
+	} else {
+		prefix := escapeLike(term) + "%"
+		exact := "lower(users.username) = @term OR lower(users.email) = @term OR users.phone = @raw"
+
+		matches := "lower(users.username) LIKE @prefix OR lower(users.display_name) LIKE @prefix OR " + exact
+		if len([]rune(term)) >= minTrigramSearchLength {
+			matches += " OR lower(users.username) % @term OR lower(users.display_name) % @term" +
+				" OR lower(users.username) LIKE @contains OR lower(users.display_name) LIKE @contains"
+		}
+
+		args := map[string]interface{}{
+			"term":     term,
+			"raw":      search,
+			"prefix":   prefix,
+			"contains": "%" + escapeLike(term) + "%",
+		}
+
+		query = query.
+			Select("users.*, contacts.contact_id IS NOT NULL AS is_contact, "+
+				"CASE WHEN "+exact+" THEN 0 "+
+				"WHEN lower(users.username) LIKE @prefix OR lower(users.display_name) LIKE @prefix THEN 1 "+
+				"ELSE 2 END AS match_rank, "+
+				"GREATEST(similarity(lower(users.username), @term), similarity(lower(COALESCE(users.display_name, '')), @term)) AS score",
+				args).
+			Where("("+matches+")", args).
+			Order("match_rank, is_contact DESC, score DESC, users.username")
+	}
+
+	// Fetch one extra row to know whether there is another page
+	var users []models.User
+	if err := query.Limit(limit + 1).Offset(offset).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	response := gin.H{}
+	if len(users) > limit {
+		users = users[:limit]
+		response["next_offset"] = offset + limit
+	}
+
+	for i := range users {
+		if search == "" || (!strings.EqualFold(users[i].Email, search) && users[i].Phone != search) {
+			users[i].Email = ""
+			users[i].Phone = ""
+		}
+	}
+	maskPresence(users, user.ID)
+
+	response["users"] = users
+	c.JSON(http.StatusOK, response)
+}
+
+// escapeLike escapes LIKE wildcards so the term is matched literally.
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
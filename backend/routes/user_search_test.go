@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func searchUsers(user models.User, query string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/users?"+query, nil)
+	c.Set("user", user)
+	GetUsers(c)
+	return recorder
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct{ term, want string }{
+		{"alice", "alice"},
+		{"100%", `100\%`},
+		{"a_b", `a\_b`},
+		{`back\slash`, `back\\slash`},
+		{`%_\`, `\%\_\\`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeLike(tt.term); got != tt.want {
+			t.Errorf("escapeLike(%q) = %q, want %q", tt.term, got, tt.want)
+		}
+	}
+}
+
+func TestGetUsersRejectsInvalidPaging(t *testing.T) {
+	// Rejected before the query runs, so no database is needed
+	for _, query := range []string{"limit=0", "limit=abc", "offset=-1", "offset=x"} {
+		if recorder := searchUsers(models.User{ID: 1}, query); recorder.Code != http.StatusBadRequest {
+			t.Errorf("GET /users?%s = %d, want %d", query, recorder.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestGetUsersRanksAndPages(t *testing.T) {
+	useTestDB(t)
+
+	viewer := createTestUser(t, "search_viewer")
+	exact := createTestUser(t, "zebra")
+	contact := createTestUser(t, "zebra_contact")
+	stranger := createTestUser(t, "zebra_stranger")
+	blocker := createTestUser(t, "zebra_blocker")
+	database.DB.Create(&models.Contact{UserID: viewer.ID, ContactID: contact.ID})
+	database.DB.Create(&models.UserBlock{BlockerID: blocker.ID, BlockedID: viewer.ID})
+
+	decode := func(recorder *httptest.ResponseRecorder) ([]models.User, *int) {
+		t.Helper()
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("search = %d %s", recorder.Code, recorder.Body)
+		}
+		var body struct {
+			Users      []models.User `json:"users"`
+			NextOffset *int          `json:"next_offset"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Users, body.NextOffset
+	}
+
+	users, next := decode(searchUsers(viewer, "search=zebra"))
+	want := []uint{exact.ID, contact.ID, stranger.ID}
+	if len(users) != len(want) || next != nil {
+		t.Fatalf("search returned %d users (next %v), want %d on one page", len(users), next, len(want))
+	}
+	for i, id := range want {
+		if users[i].ID != id {
+			t.Errorf("result %d is %s, want exact match, then contact, then stranger", i, users[i].Username)
+		}
+		if users[i].Email != "" {
+			t.Errorf("%s's email was returned for a username search", users[i].Username)
+		}
+	}
+
+	users, next = decode(searchUsers(viewer, "search=zebra&limit=2"))
+	if len(users) != 2 || next == nil || *next != 2 {
+		t.Errorf("first page has %d users and next offset %v, want 2 and 2", len(users), next)
+	}
+
+	users, _ = decode(searchUsers(viewer, "search="+stranger.Email))
+	if len(users) != 1 || users[0].Email != stranger.Email {
+		t.Errorf("exact email search = %+v, want only %s with the email shown", users, stranger.Username)
+	}
+}
@@ -0,0 +1,107 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chat-backend/config"
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testPassword = "Correct-Horse-Battery-9"
+
+// useTestThrottle swaps the login throttle for a fresh in-memory one.
+func useTestThrottle(t *testing.T) {
+	t.Helper()
+
+	throttleOnce.Do(func() {})
+	previous := throttle
+	throttle = newTestThrottle()
+	t.Cleanup(func() { throttle = previous })
+}
+
+func createTestUserWithPassword(t *testing.T, username string) models.User {
+	t.Helper()
+
+	user := createTestUser(t, username)
+	if err := user.HashPassword(testPassword); err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Model(&user).Update("password", user.Password)
+	return user
+}
+
+func changePassword(hub *Hub, user models.User, current, next string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	body := fmt.Sprintf(`{"current_password": %q, "new_password": %q}`, current, next)
+	c.Request = httptest.NewRequest(http.MethodPost, "/users/me/password", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user", user)
+	ChangePassword(hub, c)
+	return recorder
+}
+
+func TestChangePasswordThrottlesWrongPasswords(t *testing.T) {
+	useTestDB(t)
+	useTestThrottle(t)
+
+	user := createTestUserWithPassword(t, "password_guess")
+	hub := NewHub()
+
+	for i := range throttle.maxFailures + 1 {
+		recorder := changePassword(hub, user, fmt.Sprintf("guess-%d", i), "Another-Password-42")
+		if recorder.Code == http.StatusTooManyRequests {
+			return
+		}
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d = %d %s, want %d", i, recorder.Code, recorder.Body, http.StatusUnauthorized)
+		}
+	}
+	t.Fatal("wrong current passwords were never throttled")
+}
+
+func TestChangePasswordRevokesTicketsAndConnections(t *testing.T) {
+	useTestDB(t)
+	useTestThrottle(t)
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("JWT_KEYS_DIR", "")
+	if err := config.LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	user := createTestUserWithPassword(t, "password_change")
+	database.DB.Create(&models.WSTicket{
+		TicketHash: config.HashToken("unused-ticket"),
+		UserID:     user.ID,
+		ExpiresAt:  time.Now().Add(wsTicketTTL),
+	})
+	hub := NewHub()
+
+	recorder := changePassword(hub, user, testPassword, "Another-Password-42")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("change password = %d %s, want %d", recorder.Code, recorder.Body, http.StatusOK)
+	}
+
+	var tickets int64
+	database.DB.Model(&models.WSTicket{}).Where("user_id = ?", user.ID).Count(&tickets)
+	if tickets != 0 {
+		t.Errorf("%d WebSocket tickets survived the password change", tickets)
+	}
+
+	select {
+	case userID := <-hub.disconnect:
+		if userID != user.ID {
+			t.Errorf("disconnected user %d, want %d", userID, user.ID)
+		}
+	default:
+		t.Error("open connections were not closed")
+	}
+}
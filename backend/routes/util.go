@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// actionError is an error with the HTTP status and message to report, shared
+// by the REST handler and the WebSocket frame for the same action.
+type actionError struct {
+	status  int
+	message string
+}
+
+func (e *actionError) Error() string { return e.message }
+
+// respondActionError writes err as JSON, using its status when it is an actionError.
+func respondActionError(c *gin.Context, err error, fallback string) {
+	var actionErr *actionError
+	if errors.As(err, &actionErr) {
+		c.JSON(actionErr.status, gin.H{"error": actionErr.message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+}
+
+// envInt reads a positive integer setting, falling back when it is unset or invalid.
+func envInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// envDuration reads a positive duration setting such as "30s", falling back
+// when it is unset or invalid.
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// randomURLString returns size random bytes, base64url encoded without padding.
+func randomURLString(size int) (string, error) {
+	raw := make([]byte, size)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// isReservedUsername reports the names @all and @here stand for, which no
+// account may take.
+func isReservedUsername(username string) bool {
+	switch strings.ToLower(username) {
+	case "all", "here":
+		return true
+	}
+	return false
+}
+
+// conversationIDsOf returns the conversations userID takes part in.
+func conversationIDsOf(userID uint) []uint {
+	var ids []uint
+	database.DB.Table("conversation_participants").Where("user_id = ?", userID).Pluck("conversation_id", &ids)
+	return ids
+}
+
+// displayNameOf is how a user is named in system messages and attributions.
+func displayNameOf(user models.User) string {
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+	return user.Username
+}
+
+// participantIDs lists the IDs of conversation's participants.
+func participantIDs(conversation models.Conversation) []uint {
+	ids := make([]uint, len(conversation.Participants))
+	for i, participant := range conversation.Participants {
+		ids[i] = participant.ID
+	}
+	return ids
+}
+
+// mapKeys lists the IDs in set, in no particular order.
+func mapKeys(set map[uint]bool) []uint {
+	keys := make([]uint, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// idSet turns ids into a set.
+func idSet(ids []uint) map[uint]bool {
+	set := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
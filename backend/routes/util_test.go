@@ -0,0 +1,16 @@
+package routes
+
+import "testing"
+
+func TestReservedUsernames(t *testing.T) {
+	for _, name := range []string{"all", "here", "ALL", "Here"} {
+		if !isReservedUsername(name) {
+			t.Errorf("%q is not reserved", name)
+		}
+	}
+	for _, name := range []string{"alice", "allen", "there"} {
+		if isReservedUsername(name) {
+			t.Errorf("%q is reserved", name)
+		}
+	}
+}
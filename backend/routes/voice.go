@@ -0,0 +1,249 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	voiceMaxBytes        = 10 << 20 // 10 MB
+	voiceMaxDuration     = 15 * time.Minute
+	voiceWaveformBuckets = 64
+	voiceURLPrefix       = "/uploads/voice/"
+)
+
+// SendVoiceNote uploads an Opus or AAC recording (multipart field "file",
+// optional "reply_to_id") and posts it as an audio message. Duration and
+// waveform are extracted from the file and stored as attachment metadata.
+func SendVoiceNote(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, voiceMaxBytes+(1<<20))
+
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Voice note file is required"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, voiceMaxBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read voice note"})
+		return
+	}
+	if len(data) > voiceMaxBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Voice note is too large"})
+		return
+	}
+
+	info, err := probeAudio(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if info.duration <= 0 || info.duration > voiceMaxDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Voice notes must be under 15 minutes long"})
+		return
+	}
+
+	var conversation models.Conversation
+	if err := database.DB.Preload("Participants").First(&conversation, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+	if err := checkCanPost(user.ID, conversation); err != nil {
+		respondActionError(c, err, "Failed to send voice note")
+		return
+	}
+
+	var replyToID *uint
+	if value := c.PostForm("reply_to_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reply_to_id"})
+			return
+		}
+		var count int64
+		database.DB.Model(&models.Message{}).
+			Scopes(visibleMessages(user.ID)).
+			Where("messages.id = ? AND messages.conversation_id = ?", id, conversation.ID).
+			Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Reply target not found"})
+			return
+		}
+		replyTo := uint(id)
+		replyToID = &replyTo
+	}
+
+	name, err := storeVoiceNote(data, user.ID, info.extension)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store voice note"})
+		return
+	}
+
+	message := models.Message{
+		ConversationID: conversation.ID,
+		SenderID:       user.ID,
+		Type:           models.AudioMessage,
+		Status:         models.MessageSent,
+		MediaURL:       voiceURLPrefix + name,
+		ReplyToID:      replyToID,
+		Attachment: &models.Attachment{
+			MimeType:   info.mimeType,
+			Size:       int64(len(data)),
+			DurationMs: info.duration.Milliseconds(),
+			Waveform:   waveform(info.packetSizes, voiceWaveformBuckets),
+		},
+	}
+
+	var mentions []models.MessageMention
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		mentions, err = saveMessage(hub, tx, &message, conversation)
+		return err
+	})
+	if err != nil {
+		os.Remove(filepath.Join(UploadDir(), "voice", name))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send voice note"})
+		return
+	}
+
+	message.Sender = user
+	message.Entities = messageEntities(message, mentions)
+	deliverMessage(hub, conversation, message, mentions)
+	clearDraftAfterSend(hub, message)
+
+	c.JSON(http.StatusCreated, gin.H{"message": message})
+}
+
+// MarkVoicePlayed records that the current user played a voice note and
+// tells its sender.
+func MarkVoicePlayed(hub *Hub, c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	if err := markVoicePlayed(hub, user.ID, uint(messageID)); err != nil {
+		respondActionError(c, err, "Failed to mark voice note as played")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Voice note marked as played"})
+}
+
+func markVoicePlayed(hub *Hub, userID, messageID uint) error {
+	var message models.Message
+	if err := database.DB.
+		Scopes(visibleMessages(userID)).
+		Where("messages.id = ? AND messages.type = ?", messageID, models.AudioMessage).
+		First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &actionError{http.StatusNotFound, "Voice note not found"}
+		}
+		return err
+	}
+
+	// Senders listening back to their own note do not count
+	if message.SenderID == userID {
+		return nil
+	}
+
+	play := models.VoicePlay{MessageID: message.ID, UserID: userID, PlayedAt: time.Now()}
+	result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&play)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	// Like read receipts, plays are only reported to the sender, and not at
+	// all when the sender blocked the listener
+	if !blockerIDsOf(userID)[message.SenderID] {
+		hub.SendToUsers([]uint{message.SenderID}, map[string]interface{}{
+			"type":            "voice_played",
+			"conversation_id": message.ConversationID,
+			"message_id":      message.ID,
+			"user_id":         userID,
+			"played_at":       play.PlayedAt,
+		})
+	}
+
+	return nil
+}
+
+// attachVoicePlays fills in played state for audio messages: Played for
+// messages viewerID received, PlayedBy for messages they sent.
+func attachVoicePlays(messages []models.Message, viewerID uint) {
+	var ids []uint
+	for i := range messages {
+		if messages[i].Type == models.AudioMessage {
+			ids = append(ids, messages[i].ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	var plays []models.VoicePlay
+	database.DB.Where("message_id IN ?", ids).Order("played_at").Find(&plays)
+
+	byMessage := map[uint][]uint{}
+	for _, play := range plays {
+		byMessage[play.MessageID] = append(byMessage[play.MessageID], play.UserID)
+	}
+	for i := range messages {
+		players := byMessage[messages[i].ID]
+		if messages[i].SenderID == viewerID {
+			messages[i].PlayedBy = players
+			continue
+		}
+		for _, playerID := range players {
+			if playerID == viewerID {
+				messages[i].Played = true
+			}
+		}
+	}
+}
+
+// storeVoiceNote writes an upload under a random name, returning the name
+// relative to the voice directory.
+func storeVoiceNote(data []byte, userID uint, extension string) (string, error) {
+	dir := filepath.Join(UploadDir(), "voice")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	// Voice notes are served statically, so the name must not be guessable
+	suffix, err := randomURLString(16)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%d-%s.%s", userID, suffix, extension)
+
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+		return "", err
+	}
+	return name, nil
+}
@@ -2,8 +2,10 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"chat-backend/database"
@@ -11,6 +13,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
 )
 
 var upgrader = websocket.Upgrader{
@@ -22,10 +25,12 @@ var upgrader = websocket.Upgrader{
 }
 
 type Client struct {
-	hub    *Hub
-	conn   *websocket.Conn
-	send   chan []byte
-	userID uint
+	hub      *Hub
+	conn     *websocket.Conn
+	send     chan []byte
+	userID   uint
+	canWrite bool // false for personal access tokens without messages:write
+	idle     bool // reported by the client; only touched on the hub goroutine
 }
 
 type Hub struct {
@@ -33,7 +38,36 @@ type Hub struct {
 	broadcast   chan []byte
 	register    chan *Client
 	unregister  chan *Client
-	userClients map[uint]*Client // Map user ID to client
+	targeted    chan targetedMessage
+	presence    chan presenceUpdate
+	typing      chan typingUpdate
+	disconnect  chan uint                 // users whose connections must all be closed
+	userClients map[uint]map[*Client]bool // A user's connections, one per device
+
+	// connected mirrors the keys of userClients for readers outside the hub
+	// goroutine, e.g. resolving @here while saving a message
+	connectedMu sync.RWMutex
+	connected   map[uint]bool
+
+	typingStates   map[typingKey]*typingState
+	typingTimeout  time.Duration
+	typingThrottle time.Duration
+}
+
+// targetedMessage is delivered only to the listed users' connections, except
+// the one it came from when skip is set.
+type targetedMessage struct {
+	userIDs []uint
+	payload []byte
+	skip    *Client
+}
+
+// presenceUpdate asks the hub to recompute a user's status, either because a
+// client reported idle/active or because the stored presence changed.
+type presenceUpdate struct {
+	userID uint
+	client *Client
+	idle   bool
 }
 
 type WSMessage struct {
@@ -41,7 +75,17 @@ type WSMessage struct {
 	ConversationID uint   `json:"conversation_id"`
 	Content        string `json:"content"`
 	MessageType    string `json:"message_type,omitempty"`
+	Format         string `json:"format,omitempty"` // plain (default) or markdown
 	ReplyToID      *uint  `json:"reply_to_id,omitempty"`
+	MessageID      uint   `json:"message_id,omitempty"` // pin_message, unpin_message and voice_played frames
+
+	// vote and retract_vote frames
+	PollID    uint   `json:"poll_id,omitempty"`
+	OptionIDs []uint `json:"option_ids,omitempty"`
+	OptionID  uint   `json:"option_id,omitempty"` // retract_vote only; 0 retracts every vote
+
+	// set_status frames
+	Status *UpdateStatusInput `json:"status,omitempty"`
 }
 
 func NewHub() *Hub {
@@ -49,39 +93,82 @@ func NewHub() *Hub {
 		broadcast:   make(chan []byte),
 		register:    make(chan *Client),
 		unregister:  make(chan *Client),
+		targeted:    make(chan targetedMessage, 256),
+		presence:    make(chan presenceUpdate, 256),
+		typing:      make(chan typingUpdate, 256),
+		disconnect:  make(chan uint, 16),
 		clients:     make(map[*Client]bool),
-		userClients: make(map[uint]*Client),
+		userClients: make(map[uint]map[*Client]bool),
+		connected:   make(map[uint]bool),
+
+		typingStates:   make(map[typingKey]*typingState),
+		typingTimeout:  envDuration("TYPING_TIMEOUT", 6*time.Second),
+		typingThrottle: envDuration("TYPING_THROTTLE", 2*time.Second),
 	}
 }
 
 func (h *Hub) Run() {
+	expiry := time.NewTicker(time.Minute)
+	defer expiry.Stop()
+	typingExpiry := time.NewTicker(time.Second)
+	defer typingExpiry.Stop()
+
 	for {
 		select {
 		case client := <-h.register:
 			h.clients[client] = true
-			h.userClients[client.userID] = client
+			if h.userClients[client.userID] == nil {
+				h.userClients[client.userID] = make(map[*Client]bool)
+			}
+			h.userClients[client.userID][client] = true
+			h.setConnected(client.userID, true)
 			log.Printf("Client connected: User ID %d", client.userID)
 
-			// Set user online
-			database.DB.Model(&models.User{}).Where("id = ?", client.userID).
-				Updates(map[string]interface{}{"status": "online", "last_seen": time.Now()})
-
-			// Broadcast status change to all clients
-			h.broadcastStatusChange(client.userID, "online")
+			h.updatePresence(client.userID, true)
 
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				delete(h.userClients, client.userID)
-				close(client.send)
+				h.removeClient(client)
 				log.Printf("Client disconnected: User ID %d", client.userID)
 
-				// Set user offline
-				database.DB.Model(&models.User{}).Where("id = ?", client.userID).
-					Updates(map[string]interface{}{"status": "offline", "last_seen": time.Now()})
+				h.stopTyping(client)
+				h.updatePresence(client.userID, true)
+			}
+
+		case userID := <-h.disconnect:
+			if len(h.userClients[userID]) == 0 {
+				continue
+			}
+			for client := range h.userClients[userID] {
+				h.removeClient(client)
+				h.stopTyping(client)
+			}
+			log.Printf("Closed all connections: User ID %d", userID)
+
+			h.updatePresence(userID, true)
+
+		case update := <-h.presence:
+			if update.client == nil {
+				h.updatePresence(update.userID, true)
+				continue
+			}
+			if _, ok := h.clients[update.client]; ok && update.client.idle != update.idle {
+				update.client.idle = update.idle
+				h.updatePresence(update.client.userID, false)
+			}
+
+		case update := <-h.typing:
+			h.handleTypingUpdate(update)
+
+		case now := <-typingExpiry.C:
+			h.expireTyping(now)
 
-				// Broadcast status change to all clients
-				h.broadcastStatusChange(client.userID, "offline")
+		case <-expiry.C:
+			h.expireCustomStatuses()
+
+		case message := <-h.targeted:
+			for _, userID := range message.userIDs {
+				h.sendToUser(userID, message.payload, message.skip)
 			}
 
 		case message := <-h.broadcast:
@@ -89,30 +176,170 @@ func (h *Hub) Run() {
 				select {
 				case client.send <- message:
 				default:
-					close(client.send)
-					delete(h.clients, client)
-					delete(h.userClients, client.userID)
+					h.removeClient(client)
 				}
 			}
 		}
 	}
 }
 
-func (h *Hub) broadcastStatusChange(userID uint, status string) {
-	statusMsg, _ := json.Marshal(map[string]interface{}{
-		"type":    "status_change",
-		"user_id": userID,
-		"status":  status,
-	})
+// DisconnectUser closes every WebSocket connection of a user, e.g. after
+// their sessions were revoked. Clients can reconnect with a fresh ticket.
+func (h *Hub) DisconnectUser(userID uint) {
+	h.disconnect <- userID
+}
+
+// removeClient forgets a connection and closes its send channel.
+func (h *Hub) removeClient(client *Client) {
+	delete(h.clients, client)
+	delete(h.userClients[client.userID], client)
+	if len(h.userClients[client.userID]) == 0 {
+		delete(h.userClients, client.userID)
+		h.setConnected(client.userID, false)
+	}
+	close(client.send)
+}
+
+func (h *Hub) setConnected(userID uint, connected bool) {
+	h.connectedMu.Lock()
+	defer h.connectedMu.Unlock()
 
-	for client := range h.clients {
+	if connected {
+		h.connected[userID] = true
+	} else {
+		delete(h.connected, userID)
+	}
+}
+
+// IsConnected reports whether the user has at least one open connection. It
+// is safe to call from any goroutine.
+func (h *Hub) IsConnected(userID uint) bool {
+	h.connectedMu.RLock()
+	defer h.connectedMu.RUnlock()
+
+	return h.connected[userID]
+}
+
+// sendToUser queues payload on each of the user's connections except skip.
+// It must run on the hub goroutine.
+func (h *Hub) sendToUser(userID uint, payload []byte, skip *Client) {
+	for client := range h.userClients[userID] {
+		if client == skip {
+			continue
+		}
 		select {
-		case client.send <- statusMsg:
+		case client.send <- payload:
 		default:
 		}
 	}
 }
 
+// SendToUsers queues an event for the given users' connections. It is safe to
+// call from HTTP handlers; delivery happens on the hub goroutine.
+func (h *Hub) SendToUsers(userIDs []uint, event map[string]interface{}) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode event: %v", err)
+		return
+	}
+
+	h.targeted <- targetedMessage{userIDs: userIDs, payload: payload}
+}
+
+// sendToOtherClients queues an event for the user's connections other than
+// client, e.g. to sync state the user changed on one device.
+func (h *Hub) sendToOtherClients(client *Client, event map[string]interface{}) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode event: %v", err)
+		return
+	}
+
+	h.targeted <- targetedMessage{userIDs: []uint{client.userID}, payload: payload, skip: client}
+}
+
+// RefreshPresence recomputes a user's status after their presence or custom
+// status changed and announces it. It is safe to call from HTTP handlers.
+func (h *Hub) RefreshPresence(userID uint) {
+	h.presence <- presenceUpdate{userID: userID}
+}
+
+// updatePresence derives the user's visible status from their chosen
+// presence and connection state, stores it, and announces it when it changed
+// (or always, with announce set).
+func (h *Hub) updatePresence(userID uint, announce bool) {
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return
+	}
+
+	connected, idle := connectionState(h.userClients[userID])
+	status := models.EffectiveStatus(user.Presence, connected, idle)
+	if status == user.Status && !announce {
+		return
+	}
+
+	if status != user.Status {
+		updates := map[string]interface{}{"status": status}
+		// Invisible users do not reveal activity through last_seen either
+		if user.Presence != models.PresenceInvisible {
+			updates["last_seen"] = time.Now()
+		}
+		database.DB.Model(&user).Updates(updates)
+		user.Status = status
+	}
+
+	h.broadcastStatusChange(user)
+}
+
+// connectionState summarizes a user's connections: a user is idle only when
+// they are connected and every one of their connections reported idle.
+func connectionState(clients map[*Client]bool) (connected, idle bool) {
+	if len(clients) == 0 {
+		return false, false
+	}
+	idle = true
+	for client := range clients {
+		idle = idle && client.idle
+	}
+	return true, idle
+}
+
+// expireCustomStatuses clears custom statuses past their expiry and
+// announces the change for each affected user.
+func (h *Hub) expireCustomStatuses() {
+	var ids []uint
+	database.DB.Model(&models.User{}).
+		Where("custom_status_expires_at IS NOT NULL AND custom_status_expires_at <= ?", time.Now()).
+		Pluck("id", &ids)
+	if len(ids) == 0 {
+		return
+	}
+
+	database.DB.Model(&models.User{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"custom_status_text":       "",
+		"custom_status_emoji":      "",
+		"custom_status_expires_at": nil,
+	})
+
+	for _, id := range ids {
+		h.updatePresence(id, true)
+	}
+}
+
+// broadcastStatusChange delivers a status change only to the users allowed
+// to see it (see presenceAudience).
+func (h *Hub) broadcastStatusChange(user models.User) {
+	statusMsg, _ := json.Marshal(statusChangeEvent(user))
+
+	for id := range presenceAudience(user) {
+		h.sendToUser(id, statusMsg, nil)
+	}
+
+	// The user's own connections learn the status they ended up with
+	h.sendToUser(user.ID, statusMsg, nil)
+}
+
 func (c *Client) readPump() {
 	defer func() {
 		c.hub.unregister <- c
@@ -143,8 +370,22 @@ func (c *Client) readPump() {
 		switch wsMsg.Type {
 		case "message":
 			c.handleNewMessage(wsMsg)
-		case "typing":
-			c.handleTyping(wsMsg)
+		case "typing_start", "typing": // "typing" is kept for older clients
+			c.handleTyping(wsMsg, true)
+		case "typing_stop":
+			c.handleTyping(wsMsg, false)
+		case "set_status":
+			c.handleSetStatus(wsMsg)
+		case "pin_message", "unpin_message":
+			c.handlePin(wsMsg)
+		case "vote", "retract_vote":
+			c.handleVote(wsMsg)
+		case "voice_played":
+			c.handleVoicePlayed(wsMsg)
+		case "set_draft":
+			c.handleSetDraft(wsMsg)
+		case "idle", "active":
+			c.hub.presence <- presenceUpdate{client: c, idle: wsMsg.Type == "idle"}
 		}
 	}
 }
@@ -185,11 +426,32 @@ func (c *Client) writePump() {
 }
 
 func (c *Client) handleNewMessage(wsMsg WSMessage) {
+	if !c.canWrite {
+		c.sendError("Token is missing the " + models.ScopeMessagesWrite + " scope")
+		return
+	}
+
 	// Save message to database
 	msgType := models.TextMessage
 	if wsMsg.MessageType != "" {
 		msgType = models.MessageType(wsMsg.MessageType)
 	}
+	// Polls carry extra data and are created through POST /conversations/:id/polls
+	if msgType == models.SystemMessage || msgType == models.PollMessage {
+		c.sendError("Invalid message type")
+		return
+	}
+
+	var conversation models.Conversation
+	if err := database.DB.Preload("Participants").First(&conversation, wsMsg.ConversationID).Error; err != nil {
+		c.sendError("Conversation not found")
+		return
+	}
+
+	if err := checkCanPost(c.userID, conversation); err != nil {
+		c.sendError(err.Error())
+		return
+	}
 
 	message := models.Message{
 		ConversationID: wsMsg.ConversationID,
@@ -198,80 +460,183 @@ func (c *Client) handleNewMessage(wsMsg WSMessage) {
 		Type:           msgType,
 		Status:         models.MessageSent,
 		ReplyToID:      wsMsg.ReplyToID,
+		Format:         models.MessageFormat(wsMsg.Format),
+	}
+	if err := applyMarkup(&message); err != nil {
+		c.sendError(err.Error())
+		return
 	}
 
-	if err := database.DB.Create(&message).Error; err != nil {
+	var mentions []models.MessageMention
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		mentions, err = saveMessage(c.hub, tx, &message, conversation)
+		return err
+	})
+	if err != nil {
 		log.Printf("Failed to save message: %v", err)
 		return
 	}
 
 	// Load sender info
 	database.DB.Preload("Sender").First(&message, message.ID)
+	message.Entities = messageEntities(message, mentions)
 
-	// Update conversation timestamp
-	database.DB.Model(&models.Conversation{}).
-		Where("id = ?", wsMsg.ConversationID).
-		Update("updated_at", time.Now())
+	// Sending a message ends the sender's typing indicator
+	c.hub.typing <- typingUpdate{userID: c.userID, conversationID: message.ConversationID}
 
-	// Broadcast to all participants
-	var conversation models.Conversation
-	database.DB.Preload("Participants").First(&conversation, wsMsg.ConversationID)
+	deliverMessage(c.hub, conversation, message, mentions)
+	unfurlLater(c.hub, conversation, message)
+	clearDraftAfterSend(c.hub, message)
+}
 
-	responseMsg, _ := json.Marshal(map[string]interface{}{
-		"type":    "new_message",
-		"message": message,
-	})
+func (c *Client) handleSetStatus(wsMsg WSMessage) {
+	if wsMsg.Status == nil {
+		c.sendError("Missing status")
+		return
+	}
 
-	for _, participant := range conversation.Participants {
-		if client, ok := c.hub.userClients[participant.ID]; ok {
-			select {
-			case client.send <- responseMsg:
-			default:
-				close(client.send)
-				delete(c.hub.clients, client)
-			}
+	if _, err := applyStatusUpdate(c.userID, *wsMsg.Status); err != nil {
+		if errors.Is(err, errInvalidStatus) {
+			c.sendError(err.Error())
+		} else {
+			c.sendError("Failed to update status")
 		}
+		return
 	}
+
+	c.hub.RefreshPresence(c.userID)
 }
 
-func (c *Client) handleTyping(wsMsg WSMessage) {
-	// Broadcast typing indicator to other participants
-	var conversation models.Conversation
-	database.DB.Preload("Participants").First(&conversation, wsMsg.ConversationID)
+func (c *Client) handlePin(wsMsg WSMessage) {
+	if !c.canWrite {
+		c.sendError("Token is missing the " + models.ScopeMessagesWrite + " scope")
+		return
+	}
 
-	responseMsg, _ := json.Marshal(map[string]interface{}{
-		"type":            "typing",
-		"conversation_id": wsMsg.ConversationID,
-		"user_id":         c.userID,
-	})
+	var err error
+	if wsMsg.Type == "pin_message" {
+		_, err = pinMessage(c.hub, c.userID, wsMsg.ConversationID, wsMsg.MessageID)
+	} else {
+		err = unpinMessage(c.hub, c.userID, wsMsg.ConversationID, wsMsg.MessageID)
+	}
+	if err != nil {
+		var actionErr *actionError
+		if errors.As(err, &actionErr) {
+			c.sendError(actionErr.message)
+		} else {
+			c.sendError("Failed to update pin")
+		}
+	}
+}
 
-	for _, participant := range conversation.Participants {
-		if participant.ID != c.userID {
-			if client, ok := c.hub.userClients[participant.ID]; ok {
-				select {
-				case client.send <- responseMsg:
-				default:
-				}
-			}
+func (c *Client) handleVote(wsMsg WSMessage) {
+	if !c.canWrite {
+		c.sendError("Token is missing the " + models.ScopeMessagesWrite + " scope")
+		return
+	}
+
+	var err error
+	if wsMsg.Type == "vote" {
+		if len(wsMsg.OptionIDs) == 0 || len(wsMsg.OptionIDs) > 10 {
+			c.sendError("option_ids must list between 1 and 10 options")
+			return
+		}
+		_, err = castVote(c.hub, c.userID, wsMsg.PollID, wsMsg.OptionIDs)
+	} else {
+		_, err = retractVote(c.hub, c.userID, wsMsg.PollID, wsMsg.OptionID)
+	}
+	if err != nil {
+		var actionErr *actionError
+		if errors.As(err, &actionErr) {
+			c.sendError(actionErr.message)
+		} else {
+			c.sendError("Failed to update vote")
+		}
+	}
+}
+
+func (c *Client) handleVoicePlayed(wsMsg WSMessage) {
+	if !c.canWrite {
+		c.sendError("Token is missing the " + models.ScopeMessagesWrite + " scope")
+		return
+	}
+
+	if err := markVoicePlayed(c.hub, c.userID, wsMsg.MessageID); err != nil {
+		var actionErr *actionError
+		if errors.As(err, &actionErr) {
+			c.sendError(actionErr.message)
+		} else {
+			c.sendError("Failed to mark voice note as played")
+		}
+	}
+}
+
+func (c *Client) handleSetDraft(wsMsg WSMessage) {
+	if !c.canWrite {
+		c.sendError("Token is missing the " + models.ScopeMessagesWrite + " scope")
+		return
+	}
+
+	draft, err := saveDraft(c.userID, wsMsg.ConversationID, DraftInput{Content: wsMsg.Content, ReplyToID: wsMsg.ReplyToID})
+	if err != nil {
+		var actionErr *actionError
+		if errors.As(err, &actionErr) {
+			c.sendError(actionErr.message)
+		} else {
+			c.sendError("Failed to save draft")
 		}
+		return
 	}
+
+	// The sending connection already has the draft
+	c.hub.sendToOtherClients(c, draftUpdatedEvent(wsMsg.ConversationID, draft))
 }
 
+// sendError reports a rejected frame back to the sending client only.
+func (c *Client) sendError(message string) {
+	errorMsg, _ := json.Marshal(map[string]interface{}{
+		"type":  "error",
+		"error": message,
+	})
+
+	select {
+	case c.send <- errorMsg:
+	default:
+	}
+}
+
+// ServeWs upgrades the connection after redeeming a ticket from POST /ws/ticket.
 func ServeWs(hub *Hub, c *gin.Context) {
-	currentUser, _ := c.Get("user")
-	user := currentUser.(models.User)
+	ticket, protocol, err := redeemWSTicket(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired ticket"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, ticket.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	var responseHeader http.Header
+	if protocol != "" {
+		responseHeader = http.Header{"Sec-Websocket-Protocol": {protocol}}
+	}
 
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, responseHeader)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
 	client := &Client{
-		hub:    hub,
-		conn:   conn,
-		send:   make(chan []byte, 256),
-		userID: user.ID,
+		hub:      hub,
+		conn:     conn,
+		send:     make(chan []byte, 256),
+		userID:   user.ID,
+		canWrite: ticket.CanWrite,
 	}
 
 	client.hub.register <- client
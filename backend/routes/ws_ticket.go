@@ -0,0 +1,95 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"chat-backend/config"
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	wsTicketTTL = 30 * time.Second
+
+	// Clients that cannot set query parameters may offer the ticket as a
+	// subprotocol: "Sec-WebSocket-Protocol: go-chat, ticket.<ticket>"
+	wsTicketProtocolPrefix = "ticket."
+	wsProtocol             = "go-chat"
+)
+
+// CreateWSTicket issues a single-use ticket for opening /ws. The ticket is
+// bound to the current user and expires after about 30 seconds.
+func CreateWSTicket(c *gin.Context) {
+	currentUser, _ := c.Get("user")
+	user := currentUser.(models.User)
+
+	ticket, err := randomURLString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ticket"})
+		return
+	}
+
+	record := models.WSTicket{
+		TicketHash: config.HashToken(ticket),
+		UserID:     user.ID,
+		CanWrite:   config.HasScope(c, models.ScopeMessagesWrite),
+		ExpiresAt:  time.Now().Add(wsTicketTTL),
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ticket"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"ticket":     ticket,
+		"expires_at": record.ExpiresAt,
+	})
+}
+
+// redeemWSTicket consumes the ticket from the ?ticket= query parameter or the
+// Sec-WebSocket-Protocol header. It returns the subprotocol to echo, if any:
+// only ever go-chat, since echoing the ticket entry would put the secret in
+// the response. A ticket offered as a subprotocol therefore needs go-chat
+// offered alongside it for browsers to accept the handshake.
+func redeemWSTicket(c *gin.Context) (models.WSTicket, string, error) {
+	ticket := c.Query("ticket")
+	protocol := ""
+	offeredTicket := ""
+
+	for _, offered := range websocket.Subprotocols(c.Request) {
+		if strings.HasPrefix(offered, wsTicketProtocolPrefix) {
+			offeredTicket = strings.TrimPrefix(offered, wsTicketProtocolPrefix)
+		} else if offered == wsProtocol {
+			protocol = wsProtocol
+		}
+	}
+
+	if ticket == "" && offeredTicket != "" {
+		if protocol == "" {
+			return models.WSTicket{}, "", errors.New("ticket subprotocol requires " + wsProtocol)
+		}
+		ticket = offeredTicket
+	}
+
+	if ticket == "" {
+		return models.WSTicket{}, "", errors.New("ticket required")
+	}
+
+	// Deleting with RETURNING makes redemption atomic, so a ticket works only once
+	var records []models.WSTicket
+	err := database.DB.Clauses(clause.Returning{}).
+		Where("ticket_hash = ? AND expires_at > ?", config.HashToken(ticket), time.Now()).
+		Delete(&records).Error
+	if err != nil || len(records) == 0 {
+		return models.WSTicket{}, "", errors.New("invalid or expired ticket")
+	}
+
+	return records[0], protocol, nil
+}
@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chat-backend/config"
+	"chat-backend/database"
+	"chat-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func wsTicketRequest(protocols string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/ws", nil)
+	c.Request.Header.Set("Sec-WebSocket-Protocol", protocols)
+	return c
+}
+
+func TestRedeemWSTicketRequiresGoChatWithTicketProtocol(t *testing.T) {
+	// Refused before the ticket is looked up, so no database is needed
+	if _, _, err := redeemWSTicket(wsTicketRequest("ticket.secret")); err == nil {
+		t.Fatal("ticket offered without the go-chat subprotocol was accepted")
+	}
+}
+
+func TestRedeemWSTicketEchoesOnlyGoChat(t *testing.T) {
+	useTestDB(t)
+
+	user := createTestUser(t, "ws_ticket")
+	ticket := "ticket-secret"
+	database.DB.Create(&models.WSTicket{
+		TicketHash: config.HashToken(ticket),
+		UserID:     user.ID,
+		ExpiresAt:  time.Now().Add(wsTicketTTL),
+	})
+
+	record, protocol, err := redeemWSTicket(wsTicketRequest("ticket." + ticket + ", go-chat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.UserID != user.ID || protocol != wsProtocol {
+		t.Errorf("redeemed ticket for user %d with protocol %q, want user %d with %q", record.UserID, protocol, user.ID, wsProtocol)
+	}
+
+	if _, _, err := redeemWSTicket(wsTicketRequest("go-chat, ticket." + ticket)); err == nil {
+		t.Error("ticket was accepted twice")
+	}
+}
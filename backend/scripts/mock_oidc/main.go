@@ -0,0 +1,37 @@
+// Command mock_oidc is a minimal OpenID Connect provider for local testing of
+// the SSO login flow. It approves every authorization request for a single
+// configurable identity and signs ID tokens with a throwaway RSA key.
+//
+//	go run ./scripts/mock_oidc -addr :9000 -email alice@example.com
+//
+// Then point the backend at it with OIDC_ISSUER=http://localhost:9000.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"chat-backend/scripts/mock_oidc/mockoidc"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL advertised in discovery")
+	subject := flag.String("sub", "mock-user-1", "subject of the issued identity")
+	email := flag.String("email", "alice@example.com", "email of the issued identity")
+	username := flag.String("username", "", "preferred_username claim (optional)")
+	flag.Parse()
+
+	provider, err := mockoidc.New(*issuer, mockoidc.Identity{
+		Subject:  *subject,
+		Email:    *email,
+		Username: *username,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Mock OIDC provider listening on %s (issuer %s)", *addr, *issuer)
+	log.Fatal(http.ListenAndServe(*addr, provider.Handler()))
+}
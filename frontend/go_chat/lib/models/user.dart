@@ -214,10 +214,12 @@ sealed class WsIncomingMessage {
     switch (json['type']) {
       case 'new_message':
         return WsNewMessage(Message.fromJson(json['message']));
-      case 'typing':
+      case 'typing_start':
+      case 'typing_stop':
         return WsTypingIndicator(
           conversationId: json['conversation_id'],
           userId: json['user_id'],
+          isTyping: json['type'] == 'typing_start',
         );
       case 'status_change':
         return WsStatusChange(
@@ -238,7 +240,12 @@ class WsNewMessage implements WsIncomingMessage {
 class WsTypingIndicator implements WsIncomingMessage {
   final int conversationId;
   final int userId;
-  WsTypingIndicator({required this.conversationId, required this.userId});
+  final bool isTyping;
+  WsTypingIndicator({
+    required this.conversationId,
+    required this.userId,
+    required this.isTyping,
+  });
 }
 
 class WsStatusChange implements WsIncomingMessage {
@@ -11,22 +11,27 @@ class MessagesState {
   final Map<int, List<Message>> messagesByConversation;
   final Map<int, bool> loadingStates;
   final Map<int, String?> errors;
+  // Users currently typing, by conversation
+  final Map<int, Set<int>> typingUsers;
 
   const MessagesState({
     this.messagesByConversation = const {},
     this.loadingStates = const {},
     this.errors = const {},
+    this.typingUsers = const {},
   });
 
   MessagesState copyWith({
     Map<int, List<Message>>? messagesByConversation,
     Map<int, bool>? loadingStates,
     Map<int, String?>? errors,
+    Map<int, Set<int>>? typingUsers,
   }) {
     return MessagesState(
       messagesByConversation: messagesByConversation ?? this.messagesByConversation,
       loadingStates: loadingStates ?? this.loadingStates,
       errors: errors ?? this.errors,
+      typingUsers: typingUsers ?? this.typingUsers,
     );
   }
 }
@@ -50,9 +55,8 @@ class MessagesNotifier extends StateNotifier<MessagesState> {
     switch (wsMessage) {
       case WsNewMessage(:final message):
         _addMessage(message);
-      case WsTypingIndicator():
-        // Could handle typing indicator here if needed
-        break;
+      case WsTypingIndicator(:final conversationId, :final userId, :final isTyping):
+        _setTyping(conversationId, userId, isTyping);
       case WsStatusChange():
         // Status changes are handled by ConversationsNotifier
         break;
@@ -99,6 +103,16 @@ class MessagesNotifier extends StateNotifier<MessagesState> {
     );
   }
 
+  void _setTyping(int conversationId, int userId, bool isTyping) {
+    final current = state.typingUsers[conversationId] ?? const <int>{};
+    if (current.contains(userId) == isTyping) return;
+
+    final updated = isTyping ? {...current, userId} : ({...current}..remove(userId));
+    state = state.copyWith(
+      typingUsers: {...state.typingUsers, conversationId: updated},
+    );
+  }
+
   void sendMessage(int conversationId, String content) {
     _wsService.sendMessage(
       conversationId: conversationId,
@@ -110,6 +124,10 @@ class MessagesNotifier extends StateNotifier<MessagesState> {
     _wsService.sendTypingIndicator(conversationId);
   }
 
+  void sendTypingStop(int conversationId) {
+    _wsService.sendTypingStop(conversationId);
+  }
+
   @override
   void dispose() {
     _wsSubscription?.cancel();
@@ -137,3 +155,8 @@ final conversationErrorProvider = Provider.family<String?, int>((ref, conversati
   final state = ref.watch(messagesNotifierProvider);
   return state.errors[conversationId];
 });
+
+final conversationTypingProvider = Provider.family<Set<int>, int>((ref, conversationId) {
+  final state = ref.watch(messagesNotifierProvider);
+  return state.typingUsers[conversationId] ?? const {};
+});
@@ -24,14 +24,21 @@ class ChatArea extends ConsumerStatefulWidget {
   ConsumerState<ChatArea> createState() => _ChatAreaState();
 }
 
+// The server drops a typing indicator after a few seconds of silence, so it
+// is renewed while the user keeps typing
+const _typingRenewInterval = Duration(seconds: 3);
+
 class _ChatAreaState extends ConsumerState<ChatArea> {
   final _messageController = TextEditingController();
   final _scrollController = ScrollController();
   int? _previousMessageCount;
+  late final MessagesNotifier _messagesNotifier;
+  DateTime? _typingSentAt;
 
   @override
   void initState() {
     super.initState();
+    _messagesNotifier = ref.read(messagesNotifierProvider.notifier);
     WidgetsBinding.instance.addPostFrameCallback((_) {
       ref.read(messagesNotifierProvider.notifier).loadMessages(widget.conversationId);
     });
@@ -41,6 +48,7 @@ class _ChatAreaState extends ConsumerState<ChatArea> {
   void didUpdateWidget(ChatArea oldWidget) {
     super.didUpdateWidget(oldWidget);
     if (oldWidget.conversationId != widget.conversationId) {
+      _stopTyping(oldWidget.conversationId);
       // Delay to avoid modifying provider during build
       Future.microtask(() {
         ref.read(messagesNotifierProvider.notifier).loadMessages(widget.conversationId);
@@ -50,6 +58,7 @@ class _ChatAreaState extends ConsumerState<ChatArea> {
 
   @override
   void dispose() {
+    _stopTyping(widget.conversationId);
     _messageController.dispose();
     _scrollController.dispose();
     super.dispose();
@@ -86,6 +95,13 @@ class _ChatAreaState extends ConsumerState<ChatArea> {
     final isGroup = conversation?.type == 'group';
     final isOnline = conversation?.isOtherUserOnline(currentUserId) ?? false;
 
+    final typingNames = ref
+        .watch(conversationTypingProvider(widget.conversationId))
+        .where((id) => id != currentUserId)
+        .map((id) => conversation?.participants.where((p) => p.id == id).firstOrNull?.username)
+        .whereType<String>()
+        .toList();
+
     return Container(
       color: AppColors.background,
       child: Column(
@@ -129,15 +145,23 @@ class _ChatAreaState extends ConsumerState<ChatArea> {
                           fontSize: 16,
                         ),
                       ),
-                      if (!isGroup)
+                      if (typingNames.isNotEmpty)
+                        Text(
+                          isGroup ? '${typingNames.join(', ')} typing...' : 'typing...',
+                          style: TextStyle(
+                            color: AppColors.primary,
+                            fontSize: 12,
+                          ),
+                        )
+                      else if (!isGroup)
                         Text(
                           isOnline ? 'Online' : 'Offline',
                           style: TextStyle(
                             color: isOnline ? AppColors.online : AppColors.textMuted,
                             fontSize: 12,
                           ),
-                        ),
-                      if (isGroup)
+                        )
+                      else
                         Text(
                           '${conversation?.participants.length ?? 0} members',
                           style: TextStyle(
@@ -194,6 +218,7 @@ class _ChatAreaState extends ConsumerState<ChatArea> {
                     ),
                     maxLines: null,
                     textInputAction: TextInputAction.send,
+                    onChanged: _onMessageChanged,
                     onSubmitted: (_) => _sendMessage(),
                   ),
                 ),
@@ -210,6 +235,25 @@ class _ChatAreaState extends ConsumerState<ChatArea> {
     );
   }
 
+  void _onMessageChanged(String text) {
+    if (text.trim().isEmpty) {
+      _stopTyping(widget.conversationId);
+      return;
+    }
+
+    final now = DateTime.now();
+    if (_typingSentAt == null || now.difference(_typingSentAt!) >= _typingRenewInterval) {
+      _messagesNotifier.sendTypingIndicator(widget.conversationId);
+      _typingSentAt = now;
+    }
+  }
+
+  void _stopTyping(int conversationId) {
+    if (_typingSentAt == null) return;
+    _typingSentAt = null;
+    _messagesNotifier.sendTypingStop(conversationId);
+  }
+
   void _sendMessage() {
     final text = _messageController.text.trim();
     if (text.isEmpty) return;
@@ -219,6 +263,8 @@ class _ChatAreaState extends ConsumerState<ChatArea> {
       text,
     );
 
+    // Sending ends the typing indicator on the server
+    _typingSentAt = null;
     _messageController.clear();
   }
 
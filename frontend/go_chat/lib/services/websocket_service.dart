@@ -1,11 +1,13 @@
 import 'dart:async';
 import 'dart:convert';
 
+import 'package:http/http.dart' as http;
 import 'package:web_socket_channel/web_socket_channel.dart';
 import '../core/config/env_config.dart';
 
 class WebSocketService {
   static String get _wsBaseUrl => EnvConfig.wsBaseUrl;
+  static String get _apiBaseUrl => EnvConfig.apiBaseUrl;
 
   WebSocketChannel? _channel;
   StreamSubscription? _subscription;
@@ -40,7 +42,10 @@ class WebSocketService {
     try {
       _cancelTimers();
 
-      final uri = Uri.parse('$_wsBaseUrl?token=$_token');
+      // Exchange the bearer token for a short-lived, single-use ticket so the
+      // token never appears in the upgrade URL
+      final ticket = await _fetchTicket();
+      final uri = Uri.parse('$_wsBaseUrl?ticket=${Uri.encodeQueryComponent(ticket)}');
       _channel = WebSocketChannel.connect(uri);
 
       await _channel!.ready;
@@ -64,6 +69,19 @@ class WebSocketService {
     }
   }
 
+  Future<String> _fetchTicket() async {
+    final response = await http.post(
+      Uri.parse('$_apiBaseUrl/ws/ticket'),
+      headers: {'Authorization': 'Bearer $_token'},
+    );
+
+    if (response.statusCode != 201) {
+      throw Exception('Failed to obtain WebSocket ticket');
+    }
+
+    return jsonDecode(response.body)['ticket'] as String;
+  }
+
   void _handleMessage(dynamic data) {
     try {
       final decoded = jsonDecode(data as String) as Map<String, dynamic>;
@@ -159,7 +177,18 @@ class WebSocketService {
     if (!_isConnected || _channel == null) return;
 
     final message = {
-      'type': 'typing',
+      'type': 'typing_start',
+      'conversation_id': conversationId,
+    };
+
+    _channel!.sink.add(jsonEncode(message));
+  }
+
+  void sendTypingStop(int conversationId) {
+    if (!_isConnected || _channel == null) return;
+
+    final message = {
+      'type': 'typing_stop',
       'conversation_id': conversationId,
     };
 